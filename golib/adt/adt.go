@@ -15,3 +15,16 @@ type ADT interface {
 type Validate interface {
 	Validate() bool
 }
+
+// Entry is a key value pair
+type Entry struct {
+	Key   Key
+	Value interface{}
+}
+
+// RangeDeleter is an ADT that deletes all keys in [lo, hi) at once
+type RangeDeleter interface {
+	ADT
+	// DeleteRange returns the number of deleted keys, and the deleted entries in key order if collect.
+	DeleteRange(lo, hi Key, collect bool) (int, []Entry)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/atriw/lib/golib/adt/bptree"
 	"github.com/atriw/lib/golib/adt/rbtree"
 	"github.com/atriw/lib/golib/adt/skiplist"
+	"github.com/atriw/lib/golib/adt/wbtree"
 )
 
 type sliceEntry struct {
@@ -62,7 +63,11 @@ var adts = []constructor{
 	func() ADT { return &slice{} },
 	func() ADT { return rbtree.New() },
 	func() ADT { return rbtree.NewLL() },
+	func() ADT { return rbtree.NewLL(rbtree.WithTopDown234()) },
+	func() ADT { return rbtree.NewLL(rbtree.WithIterative()) },
+	func() ADT { return wbtree.New() },
 	func() ADT { return skiplist.New(skiplist.WithMaxLevel(15)) },
+	func() ADT { return skiplist.NewDeterministic() },
 	func() ADT { return bptree.New(bptree.WithOrder(10)) },
 }
 
@@ -16,6 +16,52 @@ type node struct {
 	keys     keys
 	values   values
 	children children
+	// counts are the cumulative numbers of entries under children of internal nodes,
+	// counts[i] is the number under children[0] to children[i]. They are nil if the tree is uncounted.
+	counts counts
+	// prev and next link leaves in key order.
+	prev *node
+	next *node
+	// id identifies n in the store of the tree, if any.
+	id uint64
+	// stub is the store n is loaded from on first access, while n only has its id.
+	stub store
+}
+
+// store keeps the nodes of a tree outside of memory, like PagedBPTree does in pages of a file.
+// Nodes read from a store start as stubs, and the tree loads them before reading their fields.
+type store interface {
+	// load fills the stub n.
+	load(n *node)
+	// alloc gives the new node n an id.
+	alloc(n *node)
+	// free releases the node n, which is no longer in the tree.
+	free(n *node)
+}
+
+// load loads n if it is a stub, and returns n.
+func (n *node) load() *node {
+	if n != nil && n.stub != nil {
+		s := n.stub
+		n.stub = nil
+		s.load(n)
+	}
+	return n
+}
+
+// child returns the loaded ith child.
+func (n *node) child(i int) *node {
+	return n.children[i].load()
+}
+
+// nextLeaf returns the loaded next leaf, or nil.
+func (n *node) nextLeaf() *node {
+	return n.next.load()
+}
+
+// prevLeaf returns the loaded previous leaf, or nil.
+func (n *node) prevLeaf() *node {
+	return n.prev.load()
 }
 
 type keys []adt.Key
@@ -63,14 +109,109 @@ func (c children) delete(idx int, limit int) {
 	}
 }
 
+// counts are nil for nodes of trees without counts, like ConcurrentBPTree, and then they count nothing.
+type counts []int
+
+// at returns the number of entries under the ith child.
+func (c counts) at(i int) int {
+	if c == nil {
+		return 0
+	}
+	if i == 0 {
+		return c[0]
+	}
+	return c[i] - c[i-1]
+}
+
+// of returns the numbers of entries under the first limit children.
+func (c counts) of(limit int) []int {
+	nums := make([]int, limit)
+	for i := range nums {
+		nums[i] = c.at(i)
+	}
+	return nums
+}
+
+// set sets the counts from the numbers of entries under children.
+func (c counts) set(nums []int) {
+	if c == nil {
+		return
+	}
+	sum := 0
+	for i, num := range nums {
+		sum += num
+		c[i] = sum
+	}
+}
+
+// add adds d entries under the idxth child.
+func (c counts) add(d int, idx int, limit int) {
+	if c == nil {
+		return
+	}
+	for i := idx; i < limit; i++ {
+		c[i] += d
+	}
+}
+
+func (c counts) insert(count int, idx int, limit int) {
+	if c == nil {
+		return
+	}
+	for i := limit; i > idx; i-- {
+		c[i] = c[i-1] + count
+	}
+	c[idx] = count
+	if idx > 0 {
+		c[idx] += c[idx-1]
+	}
+}
+
+func (c counts) delete(idx int, limit int) {
+	if c == nil {
+		return
+	}
+	d := c.at(idx)
+	for i := idx; i < limit-1; i++ {
+		c[i] = c[i+1] - d
+	}
+}
+
+// merge moves the entries under the (idx+1)th child to the idxth one.
+func (c counts) merge(idx int) {
+	if c != nil {
+		c[idx] = c[idx+1]
+	}
+}
+
 func newNode(leaf bool, order int) *node {
-	return &node{
+	n := &node{
 		leaf: leaf,
 		// The last key of non-leaf node is always nil.
 		keys:     make(keys, order),
 		values:   make(values, order),
 		children: make(children, order),
 	}
+	if !leaf {
+		n.counts = make(counts, order)
+	}
+	return n
+}
+
+// count returns the number of entries under n, 0 for internal nodes without counts.
+func (n *node) count() int {
+	if n.leaf {
+		return n.n
+	}
+	if n.counts == nil {
+		return 0
+	}
+	return n.counts[n.n]
+}
+
+// recount recomputes the count of the ith child after it is split, merged or transferred.
+func (n *node) recount(i int) {
+	n.counts.add(n.child(i).count()-n.counts.at(i), i, n.n+1)
 }
 
 func (n *node) size() int {
@@ -102,6 +243,7 @@ func (n *node) internalInsert(key adt.Key, child *node) {
 	}
 	n.keys.insert(key, idx, n.n)
 	n.children.insert(child, idx+1, n.n+1)
+	n.counts.insert(child.count(), idx+1, n.n+1)
 	n.n++
 }
 
@@ -160,8 +302,21 @@ func (i *iterator) Next() adt.MultiWayTreeNode {
 }
 
 type BPTree struct {
-	root  *node
-	order int
+	root         *node
+	order        int
+	length       int
+	policy       SplitPolicy
+	redistribute bool
+	// prevKey and run detect sequential inserts for SplitAdaptive,
+	// run is the number of inserts in a row greater than the previous one.
+	prevKey adt.Key
+	run     int
+	// compactKey is where the next CompactStep starts, nil for the first leaf.
+	compactKey adt.Key
+	// store keeps the nodes if not nil, otherwise they are only in memory.
+	store store
+	// uncounted trees keep no counts in internal nodes, and have no CountRange.
+	uncounted bool
 }
 
 const defaultOrder = 128
@@ -186,6 +341,59 @@ func WithOrder(order int) Option {
 	}
 }
 
+// SplitPolicy decides where a full node splits.
+type SplitPolicy int
+
+const (
+	// SplitMiddle splits a full node into two halves.
+	SplitMiddle SplitPolicy = iota
+	// SplitRightBiased splits the rightmost node of each level 90/10, so that appended keys leave
+	// nodes 90% full instead of half full. Other nodes split in the middle, and only the rightmost
+	// nodes may be less than half full.
+	SplitRightBiased
+	// SplitAdaptive splits like SplitRightBiased while keys are inserted in increasing order,
+	// and like SplitMiddle otherwise.
+	SplitAdaptive
+)
+
+// sequentialRun is the number of increasing inserts in a row after which SplitAdaptive biases splits.
+const sequentialRun = 8
+
+// WithSplitPolicy sets the split policy, SplitMiddle by default.
+// ConcurrentBPTree does not detect sequential inserts, so SplitAdaptive splits in the middle there.
+func WithSplitPolicy(policy SplitPolicy) Option {
+	return func(t *BPTree) {
+		t.policy = policy
+	}
+}
+
+// WithRedistribute makes a full leaf shift keys to a sibling with room before splitting, like a B* tree,
+// which raises the fill factor of random inserts. ConcurrentBPTree ignores it.
+func WithRedistribute() Option {
+	return func(t *BPTree) {
+		t.redistribute = true
+	}
+}
+
+// newNode returns a new node allocated in the store.
+func (t *BPTree) newNode(leaf bool) *node {
+	n := newNode(leaf, t.order)
+	if t.uncounted {
+		n.counts = nil
+	}
+	if t.store != nil {
+		t.store.alloc(n)
+	}
+	return n
+}
+
+// free frees n, which is removed from the tree, in the store.
+func (t *BPTree) free(n *node) {
+	if t.store != nil {
+		t.store.free(n)
+	}
+}
+
 func (t *BPTree) Search(key adt.Key) interface{} {
 	return t.search(t.root, key)
 }
@@ -201,14 +409,14 @@ func (t *BPTree) search(n *node, key adt.Key) interface{} {
 		}
 		return n.values[idx]
 	}
-	return t.search(n.children[idx], key)
+	return t.search(n.child(idx), key)
 }
 
 func (t *BPTree) Insert(key adt.Key, value interface{}) {
 	if validate {
 		backup := adt.PrintMultiWayTree(t.root)
 		defer func() {
-			if !t.propertyHalfFull(t.root) {
+			if !t.propertyHalfFull(t.root, true) {
 				panic(fmt.Sprintf("insert %v, not half full, tree: \n%v\nbackup: \n%v\n", key, adt.PrintMultiWayTree(t.root), backup))
 			}
 			if !t.propertySameHeight() {
@@ -216,67 +424,138 @@ func (t *BPTree) Insert(key adt.Key, value interface{}) {
 			}
 		}()
 	}
+	t.track(key)
 	if t.root == nil {
-		t.root = newNode(true, t.order)
+		t.root = t.newNode(true)
 		t.root.leafInsert(key, value)
+		t.length++
 		return
 	}
-	split, lastKey := t.insert(t.root, key, value)
+	split, lastKey, added := t.insert(t.root, key, value, true)
+	if added {
+		t.length++
+	}
 	if split == nil {
 		return
 	}
-	newRoot := newNode(false, t.order)
+	newRoot := t.newNode(false)
 	newRoot.children[0] = t.root
+	newRoot.recount(0)
 	newRoot.internalInsert(lastKey, split)
 	t.root = newRoot
 }
 
-func (t *BPTree) insert(n *node, key adt.Key, value interface{}) (split *node, lastKey adt.Key) {
+// insert also reports whether key is added rather than updated.
+// rightmost is whether n is the rightmost node of its level.
+func (t *BPTree) insert(n *node, key adt.Key, value interface{}, rightmost bool) (split *node, lastKey adt.Key, added bool) {
 	if n == nil {
-		return nil, nil
+		return nil, nil, false
 	}
 	if n.leaf {
-		return t.insertLeaf(n, key, value)
+		return t.insertLeaf(n, key, value, t.biased(rightmost))
 	}
 	idx, _ := find(n.keys, key, n.n)
+	if child := n.child(idx); t.redistribute && child.leaf && child.isFull() {
+		if _, exact := find(child.keys, key, child.n); !exact && t.shift(n, idx) {
+			idx, _ = find(n.keys, key, n.n)
+		}
+	}
 	if debug {
 		fmt.Println("insert", key, n.children[idx])
 	}
-	s, l := t.insert(n.children[idx], key, value)
+	s, l, added := t.insert(n.child(idx), key, value, rightmost && idx == n.n)
 	if s == nil {
-		return nil, nil
+		if added {
+			n.counts.add(1, idx, n.n+1)
+		}
+		return nil, nil, added
+	}
+	n.recount(idx)
+	split, lastKey = t.insertInternal(n, l, s, t.biased(rightmost))
+	return split, lastKey, added
+}
+
+// track counts the run of increasing inserts for SplitAdaptive.
+func (t *BPTree) track(key adt.Key) {
+	if t.prevKey != nil && t.prevKey.Less(key) {
+		t.run++
+	} else {
+		t.run = 0
+	}
+	t.prevKey = key
+}
+
+// biased reports whether a full node splits 90/10 by the split policy.
+func (t *BPTree) biased(rightmost bool) bool {
+	switch t.policy {
+	case SplitRightBiased:
+		return rightmost
+	case SplitAdaptive:
+		return rightmost && t.run >= sequentialRun
+	}
+	return false
+}
+
+// shift moves keys from the full leaf, the idxth child of n, to a sibling with room for at least two keys,
+// so that both end up about equally full. It reports whether there is such a sibling.
+func (t *BPTree) shift(n *node, idx int) bool {
+	child := n.child(idx)
+	if idx > 0 {
+		if left := n.child(idx - 1); left.size() <= t.order-2 {
+			n.keys[idx-1] = transferRightLeft(n.keys[idx-1], child, left, (child.size()-left.size())/2)
+			n.recount(idx - 1)
+			n.recount(idx)
+			return true
+		}
+	}
+	if idx < n.n {
+		if right := n.child(idx + 1); right.size() <= t.order-2 {
+			n.keys[idx] = transferLeftRight(n.keys[idx], child, right, (child.size()-right.size())/2)
+			n.recount(idx)
+			n.recount(idx + 1)
+			return true
+		}
+	}
+	return false
+}
+
+// splitAt returns the number of keys the left node keeps when total keys split, 90% if biased.
+func splitAt(total int, biased bool) int {
+	if biased {
+		return total * 9 / 10
 	}
-	return t.insertInternal(n, l, s)
+	return total / 2
 }
 
-func (t *BPTree) insertLeaf(n *node, key adt.Key, value interface{}) (split *node, lastKey adt.Key) {
+func (t *BPTree) insertLeaf(n *node, key adt.Key, value interface{}, biased bool) (split *node, lastKey adt.Key, added bool) {
 	idx, exact := find(n.keys, key, n.n)
 	if exact {
 		n.values[idx] = value
-		return
+		return nil, nil, false
 	}
 	if !n.isFull() {
 		n.keys.insert(key, idx, n.n)
 		n.values.insert(value, idx, n.n)
 		n.n++
-		return nil, nil
+		return nil, nil, true
 	}
-	split = newNode(true, t.order)
+	split = t.newNode(true)
 	keys, values := make(keys, n.n+1), make(values, n.n+1)
 	copy(keys, n.keys)
 	copy(values, n.values)
 	keys.insert(key, idx, n.n)
 	values.insert(value, idx, n.n)
-	half := len(keys) / 2
+	half := splitAt(len(keys), biased)
 	copy(n.keys, keys[:half])
 	copy(n.values, values[:half])
 	copy(split.keys, keys[half:])
 	copy(split.values, values[half:])
 	n.n, split.n = half, len(keys)-half
-	return split, n.lastKey()
+	split.linkAfter(n)
+	return split, n.lastKey(), true
 }
 
-func (t *BPTree) insertInternal(n *node, l adt.Key, s *node) (split *node, lastKey adt.Key) {
+func (t *BPTree) insertInternal(n *node, l adt.Key, s *node, biased bool) (split *node, lastKey adt.Key) {
 	idx, exact := find(n.keys, l, n.n)
 	if exact {
 		panic("duplicate internal insert")
@@ -284,24 +563,37 @@ func (t *BPTree) insertInternal(n *node, l adt.Key, s *node) (split *node, lastK
 	if !n.isFull() {
 		n.keys.insert(l, idx, n.n)
 		n.children.insert(s, idx+1, n.n+1)
+		n.counts.insert(s.count(), idx+1, n.n+1)
 		n.n++
 		return nil, nil
 	}
 	if debug {
 		fmt.Println("split", l, adt.PrintMultiWayTreeDepth(n, 1), adt.PrintMultiWayTreeDepth(s, 1))
 	}
-	split = newNode(false, t.order)
-	keys, children := make(keys, n.n+1), make(children, n.n+2)
+	split = t.newNode(false)
+	keys, children, counts := make(keys, n.n+1), make(children, n.n+2), make(counts, n.n+2)
 	copy(keys, n.keys)
 	copy(children, n.children)
+	copy(counts, n.counts)
 	keys.insert(l, idx, n.n)
 	children.insert(s, idx+1, n.n+1)
-	half := len(keys) / 2
+	counts.insert(s.count(), idx+1, n.n+1)
+	// The split keeps at least one key.
+	half := splitAt(len(keys), biased)
+	if half > len(keys)-2 {
+		half = len(keys) - 2
+	}
 	lastKey = keys[half]
 	copy(n.keys, keys[:half])
 	copy(n.children, children[:half+1])
+	copy(n.counts, counts[:half+1])
 	copy(split.keys, keys[half+1:])
 	copy(split.children, children[half+1:])
+	if split.counts != nil {
+		for i, c := range counts[half+1:] {
+			split.counts[i] = c - counts[half]
+		}
+	}
 	n.n, split.n = half, len(keys)-half-1
 	if debug {
 		fmt.Println("split result", adt.PrintMultiWayTreeDepth(n, 1), adt.PrintMultiWayTreeDepth(split, 1))
@@ -313,7 +605,7 @@ func (t *BPTree) Delete(key adt.Key) interface{} {
 	if validate {
 		backup := adt.PrintMultiWayTree(t.root)
 		defer func() {
-			if !t.propertyHalfFull(t.root) {
+			if !t.propertyHalfFull(t.root, true) {
 				panic(fmt.Sprintf("delete %v, not half full, tree: \n%v\nbackup: \n%v\n", key, adt.PrintMultiWayTree(t.root), backup))
 			}
 			if !t.propertySameHeight() {
@@ -325,20 +617,25 @@ func (t *BPTree) Delete(key adt.Key) interface{} {
 		return nil
 	}
 	var deleted interface{}
-	t.delete(t.root, key, &deleted)
+	if _, found := t.delete(t.root, key, &deleted); found {
+		t.length--
+	}
 	if t.root.n == 0 {
-		t.root = t.root.children[0]
+		old := t.root
+		t.root = t.root.child(0)
+		t.free(old)
 	}
 	return deleted
 }
 
-func (t *BPTree) delete(n *node, key adt.Key, deleted *interface{}) (underflow bool) {
+// delete also reports whether key is found.
+func (t *BPTree) delete(n *node, key adt.Key, deleted *interface{}) (underflow bool, found bool) {
 	if n == nil {
 		return
 	}
 	if n.leaf {
-		n.leafDelete(key, deleted)
-		return n.underflow()
+		found = n.leafDelete(key, deleted)
+		return n.underflow(), found
 	}
 	// Finds the first key which is greater or equal than the needed key.
 	idx, _ := find(n.keys, key, n.n)
@@ -346,7 +643,10 @@ func (t *BPTree) delete(n *node, key adt.Key, deleted *interface{}) (underflow b
 	if debug {
 		fmt.Println("delete", key, adt.PrintMultiWayTree(n.children[idx]))
 	}
-	underflow = t.delete(n.children[idx], key, deleted)
+	underflow, found = t.delete(n.child(idx), key, deleted)
+	if found {
+		n.counts.add(-1, idx, n.n+1)
+	}
 	if !underflow {
 		return
 	}
@@ -354,29 +654,41 @@ func (t *BPTree) delete(n *node, key adt.Key, deleted *interface{}) (underflow b
 		fmt.Println("underflow", adt.PrintMultiWayTreeDepth(n.children[idx], 1))
 	}
 	if idx == n.n {
-		return t.underflow(n, idx-1, true)
+		return t.underflow(n, idx-1, true), found
 	}
-	return t.underflow(n, idx, false)
+	return t.underflow(n, idx, false), found
 }
 
 func (t *BPTree) underflow(n *node, idx int, last bool) (underflow bool) {
 	// Merge right sibling into the underflow node.
 	// And delete the sibling and the key whose right child is the sibling.
-	left := n.children[idx]
-	right := n.children[idx+1]
+	left := n.child(idx)
+	right := n.child(idx + 1)
 	if right == nil {
 		panic(adt.PrintMultiWayTreeDepth(n, 1))
 	}
 	if (!last && t.shouldMerge(right)) || (last && t.shouldMerge(left)) {
 		n.merge(n.keys[idx], left, right)
+		// The merged child has the entries of both, and the right one has none.
+		n.counts.merge(idx)
 		n.internalDelete(idx)
+		t.free(right)
 		return n.underflow()
 	}
 	from, to := right, left
 	if last {
 		from, to = to, from
 	}
+	if from.size()-to.numToFillUnderflow() < t.half() {
+		// After a biased split to may be far from half full, then filling it would underflow from.
+		if len(t.rebalance(n, idx)) == 1 {
+			return n.underflow()
+		}
+		return false
+	}
 	n.keys[idx] = n.transfer(n.keys[idx], from, to, last)
+	n.recount(idx)
+	n.recount(idx + 1)
 	if debug {
 		fmt.Println("transfer result", adt.PrintMultiWayTreeDepth(n, 1), adt.PrintMultiWayTreeDepth(from, 1), adt.PrintMultiWayTreeDepth(to, 1))
 	}
@@ -406,33 +718,71 @@ func (n *node) merge(mid adt.Key, left, right *node) {
 		// Append mid key from parent to left keys.
 		left.internalAppendRightKey(mid)
 		// Move all keys from right to left.
-		left.internalAppendRight(right.n, right.keys, right.children)
+		left.internalAppendRight(right.n, right.keys, right.children, right.counts.of(right.n))
 		// Move the last children
 		left.children[left.n] = right.children[right.n]
+		if left.counts != nil {
+			left.counts[left.n] = left.counts[left.n-1] + right.counts.at(right.n)
+		}
 		return
 	}
 	left.leafAppendRight(right.n, right.keys, right.values)
+	unlink(right, right)
+}
+
+// linkAfter links the new leaf n after the leaf prev.
+func (n *node) linkAfter(prev *node) {
+	n.prev, n.next = prev, prev.next
+	if next := prev.nextLeaf(); next != nil {
+		next.prev = n
+	}
+	prev.next = n
+}
+
+// unlink removes the leaves from first to last from the chain.
+func unlink(first, last *node) {
+	if prev := first.prevLeaf(); prev != nil {
+		prev.next = last.next
+	}
+	if next := last.nextLeaf(); next != nil {
+		next.prev = first.prev
+	}
+	first.prev, last.next = nil, nil
+}
+
+func (n *node) leftmostLeaf() *node {
+	for !n.leaf {
+		n = n.child(0)
+	}
+	return n
+}
+
+func (n *node) rightmostLeaf() *node {
+	for !n.leaf {
+		n = n.child(n.n)
+	}
+	return n
 }
 
 // Delete the idxth key and its right child in an internal node.
 func (n *node) internalDelete(idx int) {
 	n.keys.delete(idx, n.n)
 	n.children.delete(idx+1, n.n+1)
+	n.counts.delete(idx+1, n.n+1)
 	n.n--
 }
 
-// Find and delete a key in a leaf node.
-func (n *node) leafDelete(key adt.Key, deleted *interface{}) {
-	for i := 0; i < n.n; i++ {
-		if key.Equal(n.keys[i]) {
-			*deleted = n.values[i]
-			n.keys.delete(i, n.n)
-			n.values.delete(i, n.n)
-			n.n--
-			return
-		}
-		// TODO: early return
+// Find and delete a key in a leaf node, and report whether it is found.
+func (n *node) leafDelete(key adt.Key, deleted *interface{}) bool {
+	i, exact := find(n.keys, key, n.n)
+	if !exact {
+		return false
 	}
+	*deleted = n.values[i]
+	n.keys.delete(i, n.n)
+	n.values.delete(i, n.n)
+	n.n--
+	return true
 }
 
 func (n *node) underflow() bool {
@@ -475,24 +825,39 @@ func (n *node) leafAppendLeft(limit int, keys []adt.Key, values []interface{}) {
 	n.n += fill
 }
 
-func (n *node) internalAppendRight(limit int, keys []adt.Key, children []*node) {
+// internalAppendRight appends keys and children with counts, the numbers of entries under them,
+// after an appended key.
+func (n *node) internalAppendRight(limit int, keys []adt.Key, children []*node, counts []int) {
 	for i := 0; i < limit; i++ {
 		n.keys[n.n+i] = keys[i]
 		n.children[n.n+i] = children[i]
+		if n.counts != nil {
+			n.counts[n.n+i] = n.counts[n.n+i-1] + counts[i]
+		}
 	}
 	n.n += limit
 }
 
-func (n *node) internalAppendLeft(limit int, keys []adt.Key, children []*node) {
+// internalAppendLeft prepends keys and children with counts, the numbers of entries under them,
+// before a prepended key.
+func (n *node) internalAppendLeft(limit int, keys []adt.Key, children []*node, counts []int) {
 	fill := limit
+	sum := 0
+	for i := 0; i < fill; i++ {
+		sum += counts[i]
+	}
 	for i := fill + n.n - 1; i >= fill; i-- {
 		n.keys[i] = n.keys[i-fill]
 		n.children[i] = n.children[i-fill]
+		if n.counts != nil {
+			n.counts[i] = n.counts[i-fill] + sum
+		}
 	}
 	for i := 0; i < fill; i++ {
 		n.keys[i] = keys[i]
 		n.children[i] = children[i]
 	}
+	n.counts.set(counts[:fill])
 	n.n += fill
 }
 
@@ -548,30 +913,42 @@ func (n *node) leafPopRight(num int) (keys []adt.Key, values []interface{}) {
 	return keys, values
 }
 
-func (n *node) internalPopLeft(num int) (keys []adt.Key, children []*node) {
+// internalPopLeft pops the first num keys and children, and returns the numbers of entries under the children
+// as counts.
+func (n *node) internalPopLeft(num int) (keys []adt.Key, children []*node, counts []int) {
 	if n.n < num {
 		panic("pop")
 	}
 	for i := 0; i < num; i++ {
 		keys = append(keys, n.keys[i])
 		children = append(children, n.children[i])
+		counts = append(counts, n.counts.at(i))
 	}
 	for i := 0; i < n.n-num; i++ {
 		n.keys[i] = n.keys[i+num]
 		n.children[i] = n.children[i+num]
 	}
 	n.children[n.n-num] = n.children[n.n]
+	if n.counts != nil {
+		base := n.counts[num-1]
+		for i := 0; i <= n.n-num; i++ {
+			n.counts[i] = n.counts[i+num] - base
+		}
+	}
 	n.n -= num
-	return keys, children
+	return keys, children, counts
 }
 
-func (n *node) internalPopRight(num int) (keys []adt.Key, children []*node) {
+// internalPopRight pops the last num keys and children, and returns the numbers of entries under the children
+// as counts.
+func (n *node) internalPopRight(num int) (keys []adt.Key, children []*node, counts []int) {
 	for i := n.n - num; i < n.n; i++ {
 		keys = append(keys, n.keys[i])
 		children = append(children, n.children[i+1])
+		counts = append(counts, n.counts.at(i+1))
 	}
 	n.n -= num
-	return keys, children
+	return keys, children, counts
 }
 
 func (n *node) lastKey() adt.Key {
@@ -586,8 +963,8 @@ func transferRightLeft(mid adt.Key, from, to *node, num int) adt.Key {
 		return to.lastKey()
 	}
 	to.internalAppendRightKey(mid)
-	keys, children := from.internalPopLeft(num)
-	to.internalAppendRight(num, keys, children)
+	keys, children, counts := from.internalPopLeft(num)
+	to.internalAppendRight(num, keys, children, counts)
 	return to.internalPopRightKey()
 }
 
@@ -598,27 +975,288 @@ func transferLeftRight(mid adt.Key, from, to *node, num int) adt.Key {
 		return from.lastKey()
 	}
 	to.internalAppendLeftKey(mid)
-	keys, children := from.internalPopRight(num)
-	to.internalAppendLeft(num, keys, children)
+	keys, children, counts := from.internalPopRight(num)
+	to.internalAppendLeft(num, keys, children, counts)
 	return to.internalPopLeftKey()
 }
 
+// DeleteRange removes all keys in [lo, hi), and returns the number of removed keys, and the removed entries if collect.
+// Subtrees inside the range are dropped as a whole, and the underflow nodes left along the two boundaries
+// are rebalanced once on the way back up.
+func (t *BPTree) DeleteRange(lo, hi adt.Key, collect bool) (int, []adt.Entry) {
+	if t.root == nil || !lo.Less(hi) {
+		return 0, nil
+	}
+	var entries []adt.Entry
+	num, empty := t.deleteRange(t.root, lo, hi, collect, &entries)
+	t.length -= num
+	if empty {
+		t.root = nil
+		return num, entries
+	}
+	for !t.root.leaf && t.root.n == 0 {
+		old := t.root
+		t.root = t.root.child(0)
+		t.free(old)
+	}
+	return num, entries
+}
+
+// deleteRange removes keys in [lo, hi) from the subtree n, and reports whether n becomes empty, then n is freed.
+// Afterwards all nodes under n are at least half full, unless n has only one child.
+func (t *BPTree) deleteRange(n *node, lo, hi adt.Key, collect bool, entries *[]adt.Entry) (num int, empty bool) {
+	if n.leaf {
+		i, _ := find(n.keys, lo, n.n)
+		j := i
+		for ; j < n.n && n.keys[j].Less(hi); j++ {
+			if collect {
+				*entries = append(*entries, adt.Entry{Key: n.keys[j], Value: n.values[j]})
+			}
+		}
+		num = j - i
+		copy(n.keys[i:], n.keys[j:n.n])
+		copy(n.values[i:], n.values[j:n.n])
+		n.n -= num
+		if n.n == 0 {
+			unlink(n, n)
+			t.free(n)
+		}
+		return num, n.n == 0
+	}
+	// Children between i and j are inside the range.
+	i, _ := find(n.keys, lo, n.n)
+	j, _ := find(n.keys, hi, n.n)
+	num, emptyI := t.deleteRange(n.child(i), lo, hi, collect, entries)
+	if i+1 < j {
+		unlink(n.child(i+1).leftmostLeaf(), n.child(j-1).rightmostLeaf())
+	}
+	for c := i + 1; c < j; c++ {
+		num += t.drop(n.child(c), collect, entries)
+	}
+	emptyJ := false
+	if j != i {
+		var numJ int
+		numJ, emptyJ = t.deleteRange(n.child(j), lo, hi, collect, entries)
+		num += numJ
+	}
+	// Keep the children left, each but the last followed by its original right separator.
+	n.recount(i)
+	n.recount(j)
+	var keys keys
+	var children children
+	var counts []int
+	for c := 0; c <= n.n; c++ {
+		if (c > i && c < j) || (c == i && emptyI) || (c == j && emptyJ) {
+			continue
+		}
+		children = append(children, n.children[c])
+		counts = append(counts, n.counts.at(c))
+		keys = append(keys, n.keys[c])
+	}
+	if len(children) == 0 {
+		t.free(n)
+		return num, true
+	}
+	n.n = len(children) - 1
+	copy(n.keys, keys[:n.n])
+	copy(n.children, children)
+	n.counts.set(counts)
+	for c := n.n; c < len(n.keys); c++ {
+		n.keys[c] = nil
+	}
+	for c := n.n + 1; c < len(n.children); c++ {
+		n.children[c] = nil
+	}
+	t.repair(n)
+	return num, false
+}
+
+// drop returns the number of entries under n, and collects them if collect, and frees the nodes of n.
+func (t *BPTree) drop(n *node, collect bool, entries *[]adt.Entry) int {
+	defer t.free(n)
+	if n.leaf {
+		if collect {
+			for i := 0; i < n.n; i++ {
+				*entries = append(*entries, adt.Entry{Key: n.keys[i], Value: n.values[i]})
+			}
+		}
+		return n.n
+	}
+	num := 0
+	for i := 0; i <= n.n; i++ {
+		num += t.drop(n.child(i), collect, entries)
+	}
+	return num
+}
+
+// repair rebalances the underflow children of n with their siblings, then repairs the rebalanced children,
+// since an underflow child with only one child could not repair its own child.
+func (t *BPTree) repair(n *node) {
+	if n.leaf {
+		return
+	}
+	for i := 0; i <= n.n && n.n > 0; {
+		if !n.child(i).underflow() {
+			i++
+			continue
+		}
+		if i == n.n {
+			i--
+		}
+		for _, c := range t.rebalance(n, i) {
+			t.repair(c)
+		}
+	}
+}
+
+// rebalance merges the ith and (i+1)th children of n if they fit in one node, otherwise redistributes evenly.
+// It returns the resulting children.
+func (t *BPTree) rebalance(n *node, i int) []*node {
+	left, right := n.child(i), n.child(i+1)
+	if left.size()+right.size() <= t.order {
+		n.merge(n.keys[i], left, right)
+		n.counts.merge(i)
+		n.internalDelete(i)
+		t.free(right)
+		return []*node{left}
+	}
+	if left.leaf {
+		keys := append(append(keys{}, left.keys[:left.n]...), right.keys[:right.n]...)
+		values := append(append(values{}, left.values[:left.n]...), right.values[:right.n]...)
+		half := len(keys) / 2
+		copy(left.keys, keys[:half])
+		copy(left.values, values[:half])
+		copy(right.keys, keys[half:])
+		copy(right.values, values[half:])
+		left.n, right.n = half, len(keys)-half
+		n.keys[i] = left.lastKey()
+		n.recount(i)
+		n.recount(i + 1)
+		return []*node{left, right}
+	}
+	keys := append(append(append(keys{}, left.keys[:left.n]...), n.keys[i]), right.keys[:right.n]...)
+	children := append(append(children{}, left.children[:left.n+1]...), right.children[:right.n+1]...)
+	counts := append(left.counts.of(left.n+1), right.counts.of(right.n+1)...)
+	half := len(children) / 2
+	copy(left.keys, keys[:half-1])
+	copy(left.children, children[:half])
+	left.counts.set(counts[:half])
+	n.keys[i] = keys[half-1]
+	copy(right.keys, keys[half:])
+	copy(right.children, children[half:])
+	right.counts.set(counts[half:])
+	left.n, right.n = half-1, len(children)-half-1
+	n.recount(i)
+	n.recount(i + 1)
+	return []*node{left, right}
+}
+
 func (t *BPTree) Length() int {
-	return t.length(t.root)
+	return t.length
 }
 
-func (t *BPTree) length(n *node) int {
-	if n == nil {
-		return 0
+// Stats describes the shape of a BPTree.
+type Stats struct {
+	Height    int
+	Leaves    int
+	Internals int
+	// LeafFill and InternalFill are the average fractions of the order used by leaves and internal nodes.
+	LeafFill     float64
+	InternalFill float64
+}
+
+func (t *BPTree) Stats() Stats {
+	var c tally
+	level := []*node{t.root}
+	if t.root == nil {
+		level = nil
+	}
+	height := 0
+	for len(level) > 0 {
+		height++
+		var next []*node
+		for _, n := range level {
+			c.add(n.load())
+			if !n.leaf {
+				next = append(next, n.children[:n.n+1]...)
+			}
+		}
+		level = next
 	}
+	return t.tallied(height, c)
+}
+
+// tally sums the nodes and their sizes for Stats.
+type tally struct {
+	leaves, internals      int
+	leafSize, internalSize int
+}
+
+func (c *tally) add(n *node) {
 	if n.leaf {
-		return n.n
+		c.leaves++
+		c.leafSize += n.size()
+		return
 	}
-	sum := 0
+	c.internals++
+	c.internalSize += n.size()
+}
+
+// addBottom adds the bottom internal node n and its leaves.
+func (c *tally) addBottom(n *node) {
+	c.add(n)
 	for i := 0; i <= n.n; i++ {
-		sum += t.length(n.children[i])
+		c.add(n.child(i))
 	}
-	return sum
+}
+
+func (t *BPTree) tallied(height int, c tally) Stats {
+	s := Stats{Height: height, Leaves: c.leaves, Internals: c.internals}
+	if c.leaves > 0 {
+		s.LeafFill = float64(c.leafSize) / float64(c.leaves*t.order)
+	}
+	if c.internals > 0 {
+		s.InternalFill = float64(c.internalSize) / float64(c.internals*t.order)
+	}
+	return s
+}
+
+// levels returns the height of the tree.
+func (t *BPTree) levels() int {
+	h := 0
+	for n := t.root; n != nil; n = n.child(0) {
+		h++
+		if n.leaf {
+			break
+		}
+	}
+	return h
+}
+
+// CountRange returns the number of keys in [lo, hi) by the counts of internal nodes.
+// Positions within a leaf are only known from its keys, so it still reads the two leaves where lo and hi are.
+func (t *BPTree) CountRange(lo, hi adt.Key) int {
+	if t.root == nil || !lo.Less(hi) {
+		return 0
+	}
+	return t.rank(hi) - t.rank(lo)
+}
+
+// rank returns the number of keys less than key.
+// The cumulative counts give the number under the children left of the one it descends to in one lookup,
+// so each level costs only the find.
+func (t *BPTree) rank(key adt.Key) int {
+	r := 0
+	n := t.root
+	for !n.leaf {
+		idx, _ := find(n.keys, key, n.n)
+		if idx > 0 {
+			r += n.counts[idx-1]
+		}
+		n = n.child(idx)
+	}
+	idx, _ := find(n.keys, key, n.n)
+	return r + idx
 }
 
 func (t *BPTree) String() string {
@@ -626,7 +1264,63 @@ func (t *BPTree) String() string {
 }
 
 func (t *BPTree) Validate() bool {
-	return t.propertySameHeight() && t.propertyHalfFull(t.root)
+	return t.propertySameHeight() && t.propertyHalfFull(t.root, true) && t.propertyLeafChain() && t.propertyCounts()
+}
+
+// propertyCounts checks the counts of internal nodes and the length against the entries in leaves.
+func (t *BPTree) propertyCounts() bool {
+	if t.root == nil {
+		return t.length == 0
+	}
+	num, ok := t.counted(t.root)
+	return ok && num == t.length
+}
+
+func (t *BPTree) counted(n *node) (int, bool) {
+	if n.leaf {
+		return n.n, true
+	}
+	sum := 0
+	for i := 0; i <= n.n; i++ {
+		num, ok := t.counted(n.child(i))
+		if !ok || num != n.counts.at(i) {
+			return 0, false
+		}
+		sum += num
+	}
+	return sum, true
+}
+
+// propertyLeafChain checks that the leaf chain links the leaves in tree order both ways.
+func (t *BPTree) propertyLeafChain() bool {
+	var leaves []*node
+	t.leaves(t.root, &leaves)
+	for i, l := range leaves {
+		var prev, next *node
+		if i > 0 {
+			prev = leaves[i-1]
+		}
+		if i < len(leaves)-1 {
+			next = leaves[i+1]
+		}
+		if l.prev != prev || l.next != next {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *BPTree) leaves(n *node, leaves *[]*node) {
+	if n == nil {
+		return
+	}
+	if n.leaf {
+		*leaves = append(*leaves, n)
+		return
+	}
+	for i := 0; i <= n.n; i++ {
+		t.leaves(n.child(i), leaves)
+	}
 }
 
 func (t *BPTree) propertySameHeight() bool {
@@ -640,7 +1334,7 @@ func (t *BPTree) height(n *node) (int, bool) {
 	}
 	h := -1
 	for i := 0; i <= n.n; i++ {
-		ch, ok := t.height(n.children[i])
+		ch, ok := t.height(n.child(i))
 		if !ok {
 			return 0, false
 		}
@@ -652,43 +1346,59 @@ func (t *BPTree) height(n *node) (int, bool) {
 	return h, true
 }
 
-func (t *BPTree) propertyHalfFull(n *node) bool {
+// propertyHalfFull checks that nodes are at least half full, but the root and, unless splitting
+// in the middle, the rightmost nodes, which only need a key or two children.
+func (t *BPTree) propertyHalfFull(n *node, rightmost bool) bool {
 	half := t.half()
 	if n == nil {
 		return true
 	}
-	if n.leaf {
-		if n == t.root {
-			return n.n >= 1
+	if n == t.root || rightmost && t.policy != SplitMiddle {
+		half = 1
+		if !n.leaf {
+			half = 2
 		}
-		return n.n >= half
 	}
-	if n == t.root {
-		if n.size() < 2 {
-			return false
-		}
-	} else {
-		if n.size() < half {
-			return false
-		}
+	if n.size() < half {
+		return false
+	}
+	if n.leaf {
+		return true
 	}
 	for i := 0; i <= n.n; i++ {
-		if !t.propertyHalfFull(n.children[i]) {
+		if !t.propertyHalfFull(n.child(i), rightmost && i == n.n) {
 			return false
 		}
 	}
 	return true
 }
 
+// linearFindCutoff is the number of keys below which find scans linearly,
+// since it is faster than binary search for few keys.
+const linearFindCutoff = 8
+
+// find returns the index of the first key not less than target, and whether it equals target.
 func find(keys []adt.Key, target adt.Key, limit int) (idx int, exact bool) {
-	for ; idx < limit; idx++ {
-		if keys[idx].Less(target) {
-			continue
+	if limit < linearFindCutoff {
+		for ; idx < limit; idx++ {
+			if keys[idx].Less(target) {
+				continue
+			}
+			if keys[idx].Equal(target) {
+				return idx, true
+			}
+			break
 		}
-		if keys[idx].Equal(target) {
-			return idx, true
+		return idx, false
+	}
+	lo, hi := 0, limit
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if keys[mid].Less(target) {
+			lo = mid + 1
+		} else {
+			hi = mid
 		}
-		break
 	}
-	return idx, false
+	return lo, lo < limit && keys[lo].Equal(target)
 }
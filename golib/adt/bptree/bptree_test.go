@@ -1,6 +1,9 @@
 package bptree_test
 
 import (
+	"fmt"
+	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/atriw/lib/golib/adt"
@@ -23,3 +26,264 @@ func BenchmarkBPTreeInsert(b *testing.B) {
 func BenchmarkBPTreeDelete(b *testing.B) {
 	adt.XBenchDelete(b, func() adt.ADT { return New(WithOrder(11)) })
 }
+
+var benchOrders = []int{4, 16, 64, 128, 512}
+
+func BenchmarkBPTreeOrderSearch(b *testing.B) {
+	for _, order := range benchOrders {
+		order := order
+		b.Run(fmt.Sprintf("order_%v", order), func(b *testing.B) {
+			adt.XBenchSearch(b, func() adt.ADT { return New(WithOrder(order)) })
+		})
+	}
+}
+
+func BenchmarkBPTreeOrderInsert(b *testing.B) {
+	for _, order := range benchOrders {
+		order := order
+		b.Run(fmt.Sprintf("order_%v", order), func(b *testing.B) {
+			adt.XBenchInsert(b, func() adt.ADT { return New(WithOrder(order)) })
+		})
+	}
+}
+
+func BenchmarkBPTreeOrderDelete(b *testing.B) {
+	for _, order := range benchOrders {
+		order := order
+		b.Run(fmt.Sprintf("order_%v", order), func(b *testing.B) {
+			adt.XBenchDelete(b, func() adt.ADT { return New(WithOrder(order)) })
+		})
+	}
+}
+
+func TestBPTreeDeleteRange(t *testing.T) {
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return New(WithOrder(4)) })
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return New(WithOrder(7)) })
+}
+
+type key int
+
+func (k key) Less(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k < i
+}
+
+func (k key) Equal(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k == i
+}
+
+func checkCursor(t *testing.T, tree *BPTree, present map[key]bool) {
+	if !tree.Validate() {
+		t.Fatalf("Validate: broken tree\n%v", tree)
+	}
+	var sorted []key
+	for k, ok := range present {
+		if ok {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	c := tree.First()
+	for _, k := range sorted {
+		if !c.Valid() || !c.Key().Equal(k) || c.Value() != int(k) {
+			t.Fatalf("Next: expected %v, actual %v", k, c)
+		}
+		c.Next()
+	}
+	if c.Valid() {
+		t.Fatalf("Next: expected end, actual %v", c.Key())
+	}
+	c = tree.Last()
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if !c.Valid() || !c.Key().Equal(sorted[i]) {
+			t.Fatalf("Prev: expected %v, actual %v", sorted[i], c)
+		}
+		c.Prev()
+	}
+	if c.Valid() {
+		t.Fatalf("Prev: expected end, actual %v", c.Key())
+	}
+	for i := 0; i < 20; i++ {
+		k := key(rand.Intn(1001))
+		c := tree.Seek(k)
+		idx := sort.Search(len(sorted), func(i int) bool { return sorted[i] >= k })
+		if idx == len(sorted) {
+			if c.Valid() {
+				t.Fatalf("Seek: %v, expected end, actual %v", k, c.Key())
+			}
+		} else if !c.Valid() || !c.Key().Equal(sorted[idx]) {
+			t.Fatalf("Seek: %v, expected %v, actual %v", k, sorted[idx], c)
+		}
+	}
+}
+
+func TestBPTreeCursor(t *testing.T) {
+	for _, order := range []int{4, 5, 10, 64} {
+		tree := New(WithOrder(order))
+		checkCursor(t, tree, nil)
+		present := make(map[key]bool)
+		for i := 0; i < 2000; i++ {
+			k := key(rand.Intn(1000))
+			switch rand.Intn(10) {
+			case 0:
+				hi := k + key(rand.Intn(50))
+				tree.DeleteRange(k, hi, false)
+				for x := k; x < hi; x++ {
+					delete(present, x)
+				}
+			case 1, 2, 3:
+				tree.Delete(k)
+				delete(present, k)
+			default:
+				tree.Insert(k, int(k))
+				present[k] = true
+			}
+			if i%50 == 0 {
+				checkCursor(t, tree, present)
+			}
+		}
+		checkCursor(t, tree, present)
+	}
+}
+
+func TestBPTreeCountRange(t *testing.T) {
+	for _, order := range []int{4, 7} {
+		tree := New(WithOrder(order))
+		present := make(map[key]bool)
+		for i := 0; i < 3000; i++ {
+			k := key(rand.Intn(1000))
+			switch rand.Intn(10) {
+			case 0:
+				hi := k + key(rand.Intn(50))
+				tree.DeleteRange(k, hi, false)
+				for x := k; x < hi; x++ {
+					delete(present, x)
+				}
+			case 1, 2, 3:
+				tree.Delete(k)
+				delete(present, k)
+			default:
+				tree.Insert(k, int(k))
+				present[k] = true
+			}
+			if tree.Length() != len(present) {
+				t.Fatalf("Length: expected %v, actual %v", len(present), tree.Length())
+			}
+			if i%10 != 0 {
+				continue
+			}
+			if !tree.Validate() {
+				t.Fatalf("Validate: broken tree\n%v", tree)
+			}
+			lo := key(rand.Intn(1000))
+			hi := lo + key(rand.Intn(300))
+			expected := 0
+			for x := lo; x < hi; x++ {
+				if present[x] {
+					expected++
+				}
+			}
+			if actual := tree.CountRange(lo, hi); actual != expected {
+				t.Fatalf("CountRange: [%v, %v), expected %v, actual %v", lo, hi, expected, actual)
+			}
+		}
+	}
+}
+
+var splitPolicies = []struct {
+	name string
+	opts []Option
+}{
+	{"middle", nil},
+	{"right-biased", []Option{WithSplitPolicy(SplitRightBiased)}},
+	{"adaptive", []Option{WithSplitPolicy(SplitAdaptive)}},
+	{"redistribute", []Option{WithRedistribute()}},
+	{"adaptive+redistribute", []Option{WithSplitPolicy(SplitAdaptive), WithRedistribute()}},
+}
+
+func TestBPTreeSplitPolicyFill(t *testing.T) {
+	const num = 20000
+	for _, p := range splitPolicies {
+		for _, workload := range []string{"sequential", "random"} {
+			tree := New(append([]Option{WithOrder(64)}, p.opts...)...)
+			perm := rand.Perm(num)
+			for i := 0; i < num; i++ {
+				k := key(i)
+				if workload == "random" {
+					k = key(perm[i])
+				}
+				tree.Insert(k, i)
+			}
+			if !tree.Validate() {
+				t.Fatalf("Validate: %v %v, broken tree", p.name, workload)
+			}
+			s := tree.Stats()
+			t.Logf("%v %v: height %v, leaves %v, internals %v, leaf fill %.2f, internal fill %.2f",
+				p.name, workload, s.Height, s.Leaves, s.Internals, s.LeafFill, s.InternalFill)
+			biased := p.name == "right-biased" || p.name == "adaptive" || p.name == "adaptive+redistribute"
+			if workload == "sequential" && biased && s.LeafFill < 0.85 {
+				t.Errorf("%v %v: expected leaf fill at least 0.85, actual %.2f", p.name, workload, s.LeafFill)
+			}
+			if workload == "random" && p.name == "redistribute" && s.LeafFill < 0.8 {
+				t.Errorf("%v %v: expected leaf fill at least 0.8, actual %.2f", p.name, workload, s.LeafFill)
+			}
+		}
+	}
+}
+
+func TestBPTreeSplitPolicy(t *testing.T) {
+	for _, p := range splitPolicies {
+		for _, order := range []int{4, 5, 16} {
+			tree := New(append([]Option{WithOrder(order)}, p.opts...)...)
+			present := make(map[key]bool)
+			next := key(0)
+			for i := 0; i < 3000; i++ {
+				k := key(rand.Intn(1000))
+				switch rand.Intn(10) {
+				case 0:
+					hi := k + key(rand.Intn(50))
+					tree.DeleteRange(k, hi, false)
+					for x := k; x < hi; x++ {
+						delete(present, x)
+					}
+				case 1, 2, 3:
+					tree.Delete(k)
+					delete(present, k)
+				case 4, 5, 6:
+					// Runs of appends exercise the biased splits.
+					for j := 0; j < 10; j++ {
+						tree.Insert(1000+next, int(1000+next))
+						present[1000+next] = true
+						next++
+					}
+				default:
+					tree.Insert(k, int(k))
+					present[k] = true
+				}
+				if i%10 == 0 {
+					checkCursor(t, tree, present)
+				}
+			}
+			checkCursor(t, tree, present)
+		}
+	}
+}
+
+// TestBPTreeBiasedSplitUnderflow empties the small right node of a biased split,
+// which is then refilled without underflowing its full sibling.
+func TestBPTreeBiasedSplitUnderflow(t *testing.T) {
+	for _, order := range []int{5, 6, 16} {
+		tree := New(WithOrder(order), WithSplitPolicy(SplitRightBiased))
+		present := make(map[key]bool)
+		for i := 0; i <= order; i++ {
+			tree.Insert(key(i), i)
+			present[key(i)] = true
+		}
+		for i := order; tree.Stats().Leaves > 1; i-- {
+			tree.Delete(key(i))
+			delete(present, key(i))
+			checkCursor(t, tree, present)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package bptree
+
+import (
+	"container/list"
+	"encoding/binary"
+)
+
+// frame caches a page in the buffer pool.
+type frame struct {
+	id   uint64
+	data []byte
+	pins int
+	// dirty frames are written back on eviction or flush.
+	dirty bool
+	// elem is the element in the LRU list while the frame is unpinned.
+	elem *list.Element
+}
+
+// PoolStats are counters of the buffer pool of PagedBPTree.
+type PoolStats struct {
+	Hits       int
+	Misses     int
+	Evictions  int
+	WriteBacks int
+}
+
+// bufferPool caches up to size unpinned pages in frames, and evicts the least recently used unpinned frame.
+// Pinned frames are never evicted, so the pool grows beyond size while more than size frames are pinned.
+type bufferPool struct {
+	pager  *pager
+	size   int
+	frames map[uint64]*frame
+	// lru holds unpinned frames, the most recently used at the front.
+	lru   *list.List
+	stats PoolStats
+}
+
+func newBufferPool(p *pager, size int) *bufferPool {
+	return &bufferPool{pager: p, size: size, frames: make(map[uint64]*frame), lru: list.New()}
+}
+
+// fetch pins and returns the frame of page id, reading it if not cached.
+func (b *bufferPool) fetch(id uint64) (*frame, error) {
+	if f, ok := b.frames[id]; ok {
+		b.stats.Hits++
+		b.pin(f)
+		return f, nil
+	}
+	b.stats.Misses++
+	f, err := b.victim()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.pager.read(id, f.data); err != nil {
+		return nil, err
+	}
+	f.id = id
+	b.frames[id] = f
+	b.pin(f)
+	return f, nil
+}
+
+// allocate takes a page off the free list, or appends a page to the file, and pins and returns its frame.
+// The frame keeps the old data of a freed page, and is zeroed for an appended page.
+func (b *bufferPool) allocate() (*frame, error) {
+	if id := b.pager.freeHead; id != 0 {
+		f, err := b.fetch(id)
+		if err != nil {
+			return nil, err
+		}
+		if f.data[0] != kindFree {
+			b.unpin(f, false)
+			return nil, ErrCorrupted
+		}
+		b.pager.freeHead = binary.LittleEndian.Uint64(f.data[1:])
+		return f, nil
+	}
+	f, err := b.victim()
+	if err != nil {
+		return nil, err
+	}
+	for i := range f.data {
+		f.data[i] = 0
+	}
+	f.id = b.pager.count
+	b.pager.count++
+	b.frames[f.id] = f
+	b.pin(f)
+	return f, nil
+}
+
+// victim returns a free frame, evicting the least recently used unpinned frame if the pool is full,
+// or a new frame if all frames are pinned.
+func (b *bufferPool) victim() (*frame, error) {
+	e := b.lru.Back()
+	if len(b.frames) < b.size || e == nil {
+		return &frame{data: make([]byte, b.pager.pageSize)}, nil
+	}
+	f := e.Value.(*frame)
+	if err := b.evict(f); err != nil {
+		return nil, err
+	}
+	return &frame{data: f.data}, nil
+}
+
+// evict writes back the unpinned frame f if dirty, and drops it.
+func (b *bufferPool) evict(f *frame) error {
+	if f.dirty {
+		if err := b.pager.write(f.id, f.data); err != nil {
+			return err
+		}
+		b.stats.WriteBacks++
+	}
+	b.stats.Evictions++
+	b.lru.Remove(f.elem)
+	delete(b.frames, f.id)
+	return nil
+}
+
+// trim evicts unpinned frames until the pool has at most size frames.
+func (b *bufferPool) trim() error {
+	for len(b.frames) > b.size && b.lru.Len() > 0 {
+		if err := b.evict(b.lru.Back().Value.(*frame)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bufferPool) pin(f *frame) {
+	if f.elem != nil {
+		b.lru.Remove(f.elem)
+		f.elem = nil
+	}
+	f.pins++
+}
+
+// unpin releases a pin of f, and marks it dirty if the page is modified.
+func (b *bufferPool) unpin(f *frame, dirty bool) {
+	if f.pins <= 0 {
+		panic("unpin an unpinned frame")
+	}
+	f.dirty = f.dirty || dirty
+	f.pins--
+	if f.pins == 0 {
+		f.elem = b.lru.PushFront(f)
+	}
+}
+
+// discard drops the pinned frame f without writing it back.
+func (b *bufferPool) discard(f *frame) {
+	if f.pins <= 0 {
+		panic("discard an unpinned frame")
+	}
+	delete(b.frames, f.id)
+}
+
+// pinned reports whether any frame is pinned.
+func (b *bufferPool) pinned() bool {
+	return len(b.frames) != b.lru.Len()
+}
+
+// flush writes back all dirty frames.
+func (b *bufferPool) flush() error {
+	for _, f := range b.frames {
+		if !f.dirty {
+			continue
+		}
+		if err := b.pager.write(f.id, f.data); err != nil {
+			return err
+		}
+		f.dirty = false
+		b.stats.WriteBacks++
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package bptree
+
+import (
+	"math"
+)
+
+// Compact rebuilds the tree bottom up with nodes filled to targetFill of the order, but at least half full,
+// which shrinks the height where it can. It returns the stats before and after.
+func (t *BPTree) Compact(targetFill float64) (before, after Stats) {
+	before = t.Stats()
+	per := t.perNode(targetFill)
+	t.compactKey = nil
+	if t.root == nil {
+		return before, before
+	}
+	var keys keys
+	var values values
+	for c := t.First(); c.Valid(); c.Next() {
+		keys = append(keys, c.Key())
+		values = append(values, c.Value())
+	}
+	t.drop(t.root, false, nil)
+	var level []*node
+	off := 0
+	for _, size := range t.groups(len(keys), per) {
+		n := t.newNode(true)
+		copy(n.keys, keys[off:off+size])
+		copy(n.values, values[off:off+size])
+		n.n = size
+		if len(level) > 0 {
+			n.linkAfter(level[len(level)-1])
+		}
+		level = append(level, n)
+		off += size
+	}
+	for len(level) > 1 {
+		var next []*node
+		off = 0
+		for _, size := range t.groups(len(level), per) {
+			n := t.newNode(false)
+			for i, c := range level[off : off+size] {
+				n.children[i] = c
+				n.counts[i] = c.count()
+				if i > 0 {
+					n.counts[i] += n.counts[i-1]
+					n.keys[i-1] = n.children[i-1].rightmostLeaf().lastKey()
+				}
+			}
+			n.n = size - 1
+			next = append(next, n)
+			off += size
+		}
+		level = next
+	}
+	t.root = level[0]
+	return before, t.Stats()
+}
+
+// CompactStep incrementally compacts leaves, starting where the last call stopped. It repacks the leaves
+// under each bottom internal node to targetFill as Compact does, if that saves leaves, and then rebalances
+// the internal nodes which underflow, until it visits budget leaves, rounded up to whole bottom internal nodes.
+// It reports whether it reached the last leaf, and then the next call starts over from the first.
+// The tree may be modified between calls.
+//
+// Unlike Compact, it does not repack internal nodes, so the height only shrinks where rebalancing merges
+// nodes up to the root; a full Compact is needed to bring the height down to what targetFill allows.
+// The stats before and after are of the bottom internal nodes it visits and their leaves, right before and
+// after repacking, and the height of the whole tree.
+func (t *BPTree) CompactStep(targetFill float64, budget int) (before, after Stats, done bool) {
+	per := t.perNode(targetFill)
+	var b, a tally
+	height := t.levels()
+	for budget > 0 {
+		if t.root == nil || t.root.leaf {
+			done = true
+			break
+		}
+		// Descend to the bottom internal node of compactKey.
+		var path []*node
+		var idxs []int
+		n := t.root
+		for !n.child(0).leaf {
+			idx := 0
+			if t.compactKey != nil {
+				idx, _ = find(n.keys, t.compactKey, n.n)
+			}
+			path = append(path, n)
+			idxs = append(idxs, idx)
+			n = n.child(idx)
+		}
+		budget -= n.size()
+		next := n.child(n.n).nextLeaf()
+		b.addBottom(n)
+		t.repackLeaves(n, per)
+		a.addBottom(n)
+		for i, child := len(path)-1, n; i >= 0 && child.underflow(); i, child = i-1, path[i] {
+			idx := idxs[i]
+			if idx == path[i].n {
+				idx--
+			}
+			t.rebalance(path[i], idx)
+		}
+		for !t.root.leaf && t.root.n == 0 {
+			old := t.root
+			t.root = t.root.child(0)
+			t.free(old)
+		}
+		if next == nil {
+			done = true
+			break
+		}
+		t.compactKey = next.keys[0]
+	}
+	if done {
+		t.compactKey = nil
+	}
+	return t.tallied(height, b), t.tallied(t.levels(), a), done
+}
+
+// repackLeaves regroups the leaves of the bottom internal node n to per entries, if that takes fewer leaves.
+func (t *BPTree) repackLeaves(n *node, per int) {
+	leaves := make([]*node, n.n+1)
+	for i := range leaves {
+		leaves[i] = n.child(i)
+	}
+	var keys keys
+	var values values
+	for _, l := range leaves {
+		keys = append(keys, l.keys[:l.n]...)
+		values = append(values, l.values[:l.n]...)
+	}
+	sizes := t.groups(len(keys), per)
+	if len(sizes) >= len(leaves) {
+		return
+	}
+	off := 0
+	for i, size := range sizes {
+		l := leaves[i]
+		copy(l.keys, keys[off:off+size])
+		copy(l.values, values[off:off+size])
+		for j := size; j < l.n; j++ {
+			l.keys[j], l.values[j] = nil, nil
+		}
+		l.n = size
+		n.counts[i] = off + size
+		n.keys[i] = l.lastKey()
+		off += size
+	}
+	unlink(leaves[len(sizes)], leaves[len(leaves)-1])
+	for _, l := range leaves[len(sizes):] {
+		t.free(l)
+	}
+	n.n = len(sizes) - 1
+	for i := n.n; i < len(n.keys); i++ {
+		n.keys[i] = nil
+	}
+	for i := n.n + 1; i < len(n.children); i++ {
+		n.children[i] = nil
+	}
+}
+
+// perNode returns the number of entries or children of a node filled to targetFill, but at least half full.
+func (t *BPTree) perNode(targetFill float64) int {
+	if targetFill <= 0 || targetFill > 1 {
+		panic("target fill should be in (0, 1]")
+	}
+	per := int(math.Ceil(targetFill * float64(t.order)))
+	if per < t.half() {
+		per = t.half()
+	}
+	return per
+}
+
+// groups returns the sizes of the nodes holding total entries or children, per in a node but the last two,
+// which are merged or evened out if the last would underflow.
+func (t *BPTree) groups(total, per int) []int {
+	var sizes []int
+	for ; total > per; total -= per {
+		sizes = append(sizes, per)
+	}
+	sizes = append(sizes, total)
+	if k := len(sizes); k > 1 && sizes[k-1] < t.half() {
+		sum := sizes[k-2] + sizes[k-1]
+		if sum <= t.order {
+			return append(sizes[:k-2], sum)
+		}
+		sizes[k-2], sizes[k-1] = sum-sum/2, sum/2
+	}
+	return sizes
+}
@@ -0,0 +1,97 @@
+package bptree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/atriw/lib/golib/adt/bptree"
+)
+
+// fragmented returns a tree of order with most keys in [0, 1000) deleted, and the keys left.
+func fragmented(order int, opts ...Option) (*BPTree, map[key]bool) {
+	tree := New(append([]Option{WithOrder(order)}, opts...)...)
+	present := make(map[key]bool)
+	for _, i := range rand.Perm(1000) {
+		tree.Insert(key(i), i)
+		present[key(i)] = true
+	}
+	for i := 0; i < 1000; i++ {
+		if rand.Intn(4) != 0 {
+			tree.Delete(key(i))
+			delete(present, key(i))
+		}
+	}
+	return tree, present
+}
+
+func logStats(t *testing.T, name string, s Stats) {
+	t.Logf("%v: height %v, leaves %v, internals %v, leaf fill %.2f, internal fill %.2f",
+		name, s.Height, s.Leaves, s.Internals, s.LeafFill, s.InternalFill)
+}
+
+func TestBPTreeCompact(t *testing.T) {
+	for _, order := range []int{4, 5, 16} {
+		for _, fill := range []float64{0.5, 0.7, 1} {
+			tree, present := fragmented(order)
+			before, after := tree.Compact(fill)
+			logStats(t, "before", before)
+			logStats(t, "after", after)
+			checkCursor(t, tree, present)
+			// The last two leaves may be evened out, which costs up to a leaf.
+			if after.LeafFill < fill-1/float64(after.Leaves)-0.05 {
+				t.Errorf("Compact: order %v, expected leaf fill about %v, actual %.2f", order, fill, after.LeafFill)
+			}
+			if fill == 1 && (after.Height > before.Height || after.Leaves+after.Internals >= before.Leaves+before.Internals) {
+				t.Errorf("Compact: order %v, not compacted from %+v to %+v", order, before, after)
+			}
+			// The tree keeps working afterwards.
+			for i := 0; i < 1000; i++ {
+				k := key(rand.Intn(1000))
+				if rand.Intn(2) == 0 {
+					tree.Delete(k)
+					delete(present, k)
+				} else {
+					tree.Insert(k, int(k))
+					present[k] = true
+				}
+			}
+			checkCursor(t, tree, present)
+		}
+	}
+}
+
+func TestBPTreeCompactStep(t *testing.T) {
+	for _, order := range []int{4, 5, 16} {
+		tree, present := fragmented(order, WithSplitPolicy(SplitRightBiased))
+		before := tree.Stats()
+		steps, saved := 0, 0
+		for {
+			stepBefore, stepAfter, done := tree.CompactStep(1, 8)
+			if stepAfter.Leaves > stepBefore.Leaves || stepAfter.Height > stepBefore.Height {
+				t.Errorf("CompactStep: order %v, step from %+v to %+v", order, stepBefore, stepAfter)
+			}
+			saved += stepBefore.Leaves - stepAfter.Leaves
+			if done {
+				break
+			}
+			steps++
+			checkCursor(t, tree, present)
+			// Writes between steps.
+			k := key(rand.Intn(1000))
+			if rand.Intn(2) == 0 {
+				tree.Delete(k)
+				delete(present, k)
+			} else {
+				tree.Insert(k, int(k))
+				present[k] = true
+			}
+		}
+		checkCursor(t, tree, present)
+		after := tree.Stats()
+		logStats(t, "before", before)
+		logStats(t, "after", after)
+		if steps == 0 || saved == 0 || after.Leaves >= before.Leaves || after.LeafFill <= before.LeafFill {
+			t.Errorf("CompactStep: order %v, %v steps from %+v to %+v", order, steps, before, after)
+		}
+	}
+}
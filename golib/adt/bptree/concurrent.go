@@ -0,0 +1,447 @@
+package bptree
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+// ConcurrentBPTree is a BPTree safe for concurrent use, with a RW latch per node instead of a tree-wide mutex.
+//
+// Readers crab down with read latches, holding a node until its child is latched.
+// Writers first descend optimistically with read latches and write latch only the leaf,
+// and retry pessimistically if the leaf would split or underflow.
+// A pessimistic writer crabs down with write latches, and releases the latched ancestors
+// once a child is safe, that is it neither splits nor underflows by the operation.
+// Leaves are latched left to right along the leaf chain, so scans only go forward.
+// Latches are kept in a table of the tree indexed by node ids rather than in nodes, so that other trees
+// do not pay for them.
+//
+// Optimistic writers can not update the subtree counts of ancestors, so internal nodes keep no counts,
+// and there is no CountRange.
+type ConcurrentBPTree struct {
+	t BPTree
+	// rootLatch guards t.root.
+	rootLatch sync.RWMutex
+	latches   *latchTable
+	length    int64
+}
+
+func NewConcurrent(opts ...Option) *ConcurrentBPTree {
+	c := &ConcurrentBPTree{t: *New(opts...), latches: newLatchTable()}
+	c.t.store, c.t.uncounted = c.latches, true
+	return c
+}
+
+// latch returns the latch of n.
+func (c *ConcurrentBPTree) latch(n *node) *sync.RWMutex {
+	return c.latches.latch(n)
+}
+
+// latchChunkSize is the number of latches in a chunk of latchTable.
+const latchChunkSize = 256
+
+type latchChunk [latchChunkSize]sync.RWMutex
+
+// latchTable is the store of ConcurrentBPTree. It keeps nodes in memory, and gives them small ids,
+// reused after they are freed, which index their latches in chunks. Readers find a latch without locking
+// through the directory of chunks, which is only replaced by a larger copy.
+type latchTable struct {
+	// dir is the []*latchChunk directory.
+	dir atomic.Value
+	// mu guards growing dir, next and freed.
+	mu sync.Mutex
+	// next is the next new id, and freed are the ids to reuse.
+	next  uint64
+	freed []uint64
+}
+
+func newLatchTable() *latchTable {
+	l := &latchTable{}
+	l.dir.Store([]*latchChunk(nil))
+	return l
+}
+
+func (l *latchTable) latch(n *node) *sync.RWMutex {
+	dir := l.dir.Load().([]*latchChunk)
+	return &dir[n.id/latchChunkSize][n.id%latchChunkSize]
+}
+
+func (l *latchTable) load(n *node) {
+	panic("nodes of ConcurrentBPTree are never stubs")
+}
+
+func (l *latchTable) alloc(n *node) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last := len(l.freed) - 1; last >= 0 {
+		n.id, l.freed = l.freed[last], l.freed[:last]
+		return
+	}
+	n.id = l.next
+	l.next++
+	if dir := l.dir.Load().([]*latchChunk); n.id == uint64(len(dir))*latchChunkSize {
+		l.dir.Store(append(dir[:len(dir):len(dir)], &latchChunk{}))
+	}
+}
+
+// free makes the id of n reusable. The writer which removed n may still hold its latch, but it acquires no other
+// latch before releasing it, so others reaching a new node of the id only wait.
+func (l *latchTable) free(n *node) {
+	l.mu.Lock()
+	l.freed = append(l.freed, n.id)
+	l.mu.Unlock()
+}
+
+func (c *ConcurrentBPTree) Search(key adt.Key) interface{} {
+	c.rootLatch.RLock()
+	n := c.t.root
+	if n == nil {
+		c.rootLatch.RUnlock()
+		return nil
+	}
+	c.latch(n).RLock()
+	c.rootLatch.RUnlock()
+	n = c.descend(n, key)
+	defer c.latch(n).RUnlock()
+	idx, exact := find(n.keys, key, n.n)
+	if !exact {
+		return nil
+	}
+	return n.values[idx]
+}
+
+// descend crabs down from the read latched n to the leaf of key, and returns it read latched.
+func (c *ConcurrentBPTree) descend(n *node, key adt.Key) *node {
+	for !n.leaf {
+		idx, _ := find(n.keys, key, n.n)
+		child := n.children[idx]
+		c.latch(child).RLock()
+		c.latch(n).RUnlock()
+		n = child
+	}
+	return n
+}
+
+// Scan calls fn on each key in [lo, hi) in order until fn returns false.
+// The leaf of the key is read latched during fn, so fn must not modify the tree.
+func (c *ConcurrentBPTree) Scan(lo, hi adt.Key, fn func(key adt.Key, value interface{}) bool) {
+	c.rootLatch.RLock()
+	n := c.t.root
+	if n == nil {
+		c.rootLatch.RUnlock()
+		return
+	}
+	c.latch(n).RLock()
+	c.rootLatch.RUnlock()
+	n = c.descend(n, lo)
+	idx, _ := find(n.keys, lo, n.n)
+	for {
+		for ; idx < n.n; idx++ {
+			if !n.keys[idx].Less(hi) || !fn(n.keys[idx], n.values[idx]) {
+				c.latch(n).RUnlock()
+				return
+			}
+		}
+		next := n.next
+		if next == nil {
+			c.latch(n).RUnlock()
+			return
+		}
+		c.latch(next).RLock()
+		c.latch(n).RUnlock()
+		n, idx = next, 0
+	}
+}
+
+func (c *ConcurrentBPTree) Insert(key adt.Key, value interface{}) {
+	if !c.insertOptimistic(key, value) {
+		c.insertPessimistic(key, value)
+	}
+}
+
+// leafLatched crabs down with read latches to the leaf of key, and returns it write latched,
+// and whether it is the root. It returns nil if the tree is empty.
+func (c *ConcurrentBPTree) leafLatched(key adt.Key) (*node, bool) {
+	c.rootLatch.RLock()
+	n := c.t.root
+	if n == nil {
+		c.rootLatch.RUnlock()
+		return nil, false
+	}
+	if n.leaf {
+		c.latch(n).Lock()
+		c.rootLatch.RUnlock()
+		return n, true
+	}
+	c.latch(n).RLock()
+	c.rootLatch.RUnlock()
+	for {
+		idx, _ := find(n.keys, key, n.n)
+		child := n.children[idx]
+		if child.leaf {
+			c.latch(child).Lock()
+			c.latch(n).RUnlock()
+			return child, false
+		}
+		c.latch(child).RLock()
+		c.latch(n).RUnlock()
+		n = child
+	}
+}
+
+// insertOptimistic inserts if the leaf does not split, and reports whether it does.
+func (c *ConcurrentBPTree) insertOptimistic(key adt.Key, value interface{}) bool {
+	n, _ := c.leafLatched(key)
+	if n == nil {
+		return false
+	}
+	defer c.latch(n).Unlock()
+	if _, exact := find(n.keys, key, n.n); !exact && n.isFull() {
+		return false
+	}
+	if _, _, added := c.t.insertLeaf(n, key, value, false); added {
+		atomic.AddInt64(&c.length, 1)
+	}
+	return true
+}
+
+// latched is the write latched path of a pessimistic writer.
+type latched struct {
+	c    *ConcurrentBPTree
+	root bool
+	// nodes are latched nodes from the top, latches are their latches, idxs are their indexes in their parents,
+	// and rightmost are whether they are the rightmost nodes of their levels.
+	// Latches are kept since the nodes may be dropped from the tree before release.
+	nodes     []*node
+	latches   []*sync.RWMutex
+	idxs      []int
+	rightmost []bool
+}
+
+func (l *latched) push(n *node, idx int, rightmost bool) {
+	latch := l.c.latch(n)
+	latch.Lock()
+	l.nodes = append(l.nodes, n)
+	l.latches = append(l.latches, latch)
+	l.idxs = append(l.idxs, idx)
+	l.rightmost = append(l.rightmost, rightmost)
+}
+
+// unlock releases the latch of the ith node.
+func (l *latched) unlock(i int) {
+	if l.latches[i] != nil {
+		l.latches[i].Unlock()
+		l.latches[i] = nil
+	}
+}
+
+// releaseAbove releases the latches above the last node, since it is safe.
+func (l *latched) releaseAbove() {
+	last := len(l.nodes) - 1
+	for i := range l.nodes[:last] {
+		l.unlock(i)
+	}
+	l.nodes = append(l.nodes[:0], l.nodes[last])
+	l.latches = append(l.latches[:0], l.latches[last])
+	l.idxs = append(l.idxs[:0], l.idxs[last])
+	l.rightmost = append(l.rightmost[:0], l.rightmost[last])
+	if l.root {
+		l.c.rootLatch.Unlock()
+		l.root = false
+	}
+}
+
+func (l *latched) release() {
+	for i := range l.nodes {
+		l.unlock(i)
+	}
+	if l.root {
+		l.c.rootLatch.Unlock()
+	}
+}
+
+func (c *ConcurrentBPTree) insertPessimistic(key adt.Key, value interface{}) {
+	c.rootLatch.Lock()
+	if c.t.root == nil {
+		c.t.root = c.t.newNode(true)
+		c.t.root.leafInsert(key, value)
+		atomic.AddInt64(&c.length, 1)
+		c.rootLatch.Unlock()
+		return
+	}
+	l := &latched{c: c, root: true}
+	defer l.release()
+	n := c.t.root
+	l.push(n, -1, true)
+	for {
+		if n.size() < c.t.order {
+			l.releaseAbove()
+		}
+		if n.leaf {
+			break
+		}
+		idx, _ := find(n.keys, key, n.n)
+		rightmost := l.rightmost[len(l.rightmost)-1] && idx == n.n
+		n = n.children[idx]
+		l.push(n, idx, rightmost)
+	}
+	// A split links a new leaf before the next leaf.
+	if next := n.next; next != nil && n.isFull() {
+		latch := c.latch(next)
+		latch.Lock()
+		defer latch.Unlock()
+	}
+	split, lastKey, added := c.t.insertLeaf(n, key, value, c.t.biased(n.next == nil))
+	if added {
+		atomic.AddInt64(&c.length, 1)
+	}
+	for i := len(l.nodes) - 2; i >= 0 && split != nil; i-- {
+		split, lastKey = c.t.insertInternal(l.nodes[i], lastKey, split, c.t.biased(l.rightmost[i]))
+	}
+	if split != nil {
+		// The root split, so the root latch is held.
+		newRoot := c.t.newNode(false)
+		newRoot.children[0] = c.t.root
+		newRoot.recount(0)
+		newRoot.internalInsert(lastKey, split)
+		c.t.root = newRoot
+	}
+}
+
+func (c *ConcurrentBPTree) Delete(key adt.Key) interface{} {
+	if deleted, ok := c.deleteOptimistic(key); ok {
+		return deleted
+	}
+	return c.deletePessimistic(key)
+}
+
+// deleteOptimistic deletes if the leaf does not underflow, and reports whether it does.
+func (c *ConcurrentBPTree) deleteOptimistic(key adt.Key) (interface{}, bool) {
+	n, root := c.leafLatched(key)
+	if n == nil {
+		return nil, true
+	}
+	defer c.latch(n).Unlock()
+	if _, exact := find(n.keys, key, n.n); exact && !c.safeDelete(n, root) {
+		return nil, false
+	}
+	var deleted interface{}
+	if n.leafDelete(key, &deleted) {
+		atomic.AddInt64(&c.length, -1)
+	}
+	return deleted, true
+}
+
+// safeDelete reports whether n does not underflow after deleting a key or child.
+// The root is unsafe if it would be empty or have only one child.
+func (c *ConcurrentBPTree) safeDelete(n *node, root bool) bool {
+	if root {
+		return n.size() > 2 || n.leaf && n.size() == 2
+	}
+	return n.size() > c.t.half()
+}
+
+func (c *ConcurrentBPTree) deletePessimistic(key adt.Key) interface{} {
+	c.rootLatch.Lock()
+	if c.t.root == nil {
+		c.rootLatch.Unlock()
+		return nil
+	}
+	l := &latched{c: c, root: true}
+	defer l.release()
+	n := c.t.root
+	l.push(n, -1, true)
+	for {
+		if c.safeDelete(n, n == l.nodes[0] && l.root) {
+			l.releaseAbove()
+		}
+		if n.leaf {
+			break
+		}
+		idx, _ := find(n.keys, key, n.n)
+		n = n.children[idx]
+		l.push(n, idx, false)
+	}
+	var deleted interface{}
+	if !n.leafDelete(key, &deleted) {
+		return nil
+	}
+	atomic.AddInt64(&c.length, -1)
+	underflow := n.underflow()
+	for i := len(l.nodes) - 1; i > 0 && underflow; i-- {
+		parent, idx := l.nodes[i-1], l.idxs[i]
+		// Release the child to latch the siblings left to right.
+		l.unlock(i)
+		last := idx == parent.n
+		if last {
+			idx--
+		}
+		left, right := parent.children[idx], parent.children[idx+1]
+		leftLatch, rightLatch := c.latch(left), c.latch(right)
+		leftLatch.Lock()
+		rightLatch.Lock()
+		// A leaf merge unlinks right before the next leaf.
+		var nextLatch *sync.RWMutex
+		if next := right.next; next != nil {
+			nextLatch = c.latch(next)
+			nextLatch.Lock()
+		}
+		underflow = c.t.underflow(parent, idx, last)
+		if nextLatch != nil {
+			nextLatch.Unlock()
+		}
+		rightLatch.Unlock()
+		leftLatch.Unlock()
+	}
+	if l.root && c.t.root.n == 0 {
+		// The root latch is held since the root is unsafe.
+		old := c.t.root
+		c.t.root = old.children[0]
+		l.unlock(0)
+		c.t.free(old)
+	}
+	return deleted
+}
+
+func (c *ConcurrentBPTree) Length() int {
+	return int(atomic.LoadInt64(&c.length))
+}
+
+func (c *ConcurrentBPTree) String() string {
+	return c.t.String()
+}
+
+// Validate checks the tree like BPTree.Validate but the counts, and that the nodes in the tree are uncounted
+// and have distinct latches, and no other latch is in use.
+// It must not run concurrently with writers.
+func (c *ConcurrentBPTree) Validate() bool {
+	num := 0
+	for cur := c.t.First(); cur.Valid(); cur.Next() {
+		num++
+	}
+	return c.t.propertySameHeight() && c.t.propertyHalfFull(c.t.root, true) && c.t.propertyLeafChain() && num == c.Length() &&
+		c.propertyLatches()
+}
+
+func (c *ConcurrentBPTree) propertyLatches() bool {
+	l := c.latches
+	ids := make(map[uint64]bool)
+	ok := true
+	var walk func(n *node)
+	walk = func(n *node) {
+		ok = ok && !ids[n.id] && n.id < l.next && (n.leaf || n.counts == nil)
+		ids[n.id] = true
+		for i := 0; !n.leaf && i <= n.n; i++ {
+			walk(n.children[i])
+		}
+	}
+	if c.t.root != nil {
+		walk(c.t.root)
+	}
+	for _, id := range l.freed {
+		ok = ok && !ids[id]
+	}
+	return ok && uint64(len(ids)+len(l.freed)) == l.next
+}
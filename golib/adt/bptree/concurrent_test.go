@@ -0,0 +1,131 @@
+package bptree_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/bptree"
+)
+
+func TestConcurrentBPTree(t *testing.T) {
+	adt.XTestADT(t, NewConcurrent(WithOrder(4)))
+}
+
+// TestConcurrentBPTreeStress mixes writers of disjoint keys with readers and scanners,
+// run it with -race.
+func TestConcurrentBPTreeStress(t *testing.T) {
+	for _, opts := range [][]Option{{WithOrder(4)}, {WithOrder(5), WithSplitPolicy(SplitRightBiased)}, {WithOrder(16)}} {
+		tree := NewConcurrent(opts...)
+		const writers, keys, ops = 4, 500, 3000
+		var wg sync.WaitGroup
+		models := make([]map[key]int, writers)
+		for w := 0; w < writers; w++ {
+			models[w] = make(map[key]int)
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				r := rand.New(rand.NewSource(int64(w)))
+				model := models[w]
+				for i := 0; i < ops; i++ {
+					// Keys of writer w are w modulo writers.
+					k := key(r.Intn(keys)*writers + w)
+					if r.Intn(3) == 0 {
+						v := tree.Delete(k)
+						if expected, ok := model[k]; ok != (v != nil) || ok && v != expected {
+							t.Errorf("Delete: key %v, expected %v, actual %v", k, expected, v)
+							return
+						}
+						delete(model, k)
+						continue
+					}
+					tree.Insert(k, i)
+					model[k] = i
+					if v := tree.Search(k); v != i {
+						t.Errorf("Search: key %v, expected %v, actual %v", k, i, v)
+						return
+					}
+				}
+			}(w)
+		}
+		done := make(chan struct{})
+		var readers sync.WaitGroup
+		for r := 0; r < 2; r++ {
+			readers.Add(2)
+			go func() {
+				defer readers.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					tree.Search(key(rand.Intn(keys * writers)))
+				}
+			}()
+			go func() {
+				defer readers.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					lo := key(rand.Intn(keys * writers))
+					prev := key(-1)
+					tree.Scan(lo, lo+200, func(k adt.Key, v interface{}) bool {
+						if k.(key) < lo || k.(key) <= prev {
+							t.Errorf("Scan: key %v out of order after %v from %v", k, prev, lo)
+							return false
+						}
+						prev = k.(key)
+						return true
+					})
+				}
+			}()
+		}
+		wg.Wait()
+		close(done)
+		readers.Wait()
+
+		if !tree.Validate() {
+			t.Fatalf("Validate: broken tree\n%v", tree)
+		}
+		total := 0
+		for _, model := range models {
+			total += len(model)
+			for k, v := range model {
+				if actual := tree.Search(k); actual != v {
+					t.Fatalf("Search: key %v, expected %v, actual %v", k, v, actual)
+				}
+			}
+		}
+		if tree.Length() != total {
+			t.Fatalf("Length: expected %v, actual %v", total, tree.Length())
+		}
+	}
+}
+
+func BenchmarkConcurrentBPTreeSearch(b *testing.B) {
+	adt.XBenchSearch(b, func() adt.ADT { return NewConcurrent(WithOrder(11)) })
+}
+
+func BenchmarkConcurrentBPTreeParallel(b *testing.B) {
+	tree := NewConcurrent(WithOrder(64))
+	for i := 0; i < 100000; i++ {
+		tree.Insert(key(i), i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			k := key(r.Intn(100000))
+			if r.Intn(10) == 0 {
+				tree.Insert(k, int(k))
+			} else {
+				tree.Search(k)
+			}
+		}
+	})
+}
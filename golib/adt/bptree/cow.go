@@ -0,0 +1,216 @@
+package bptree
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+// COWBPTree is a copy-on-write BPTree whose readers never lock.
+//
+// Writers are serialized, and clone the nodes on the path from the root to the leaf they modify,
+// and the siblings they merge or transfer with, then publish the new root with an atomic swap.
+// Readers keep using whichever root they loaded, which is never modified.
+//
+// Leaves are not linked, since linking a cloned leaf would modify its neighbors, so scans walk the tree.
+// It ignores WithRedistribute.
+type COWBPTree struct {
+	// mu serializes writers, which own t.
+	mu sync.Mutex
+	t  BPTree
+	// published holds the *published of the last write.
+	published atomic.Value
+}
+
+type published struct {
+	root   *node
+	length int
+}
+
+func NewCOW(opts ...Option) *COWBPTree {
+	c := &COWBPTree{t: *New(opts...)}
+	c.published.Store(&published{})
+	return c
+}
+
+func (c *COWBPTree) load() *published {
+	return c.published.Load().(*published)
+}
+
+func (c *COWBPTree) publish() {
+	c.published.Store(&published{root: c.t.root, length: c.t.length})
+}
+
+// clone returns an unlinked copy of n.
+func (n *node) clone() *node {
+	c := &node{
+		leaf:     n.leaf,
+		n:        n.n,
+		keys:     append(keys(nil), n.keys...),
+		values:   append(values(nil), n.values...),
+		children: append(children(nil), n.children...),
+	}
+	if !n.leaf {
+		c.counts = append(counts(nil), n.counts...)
+	}
+	return c
+}
+
+func (c *COWBPTree) Search(key adt.Key) interface{} {
+	n := c.load().root
+	if n == nil {
+		return nil
+	}
+	for !n.leaf {
+		idx, _ := find(n.keys, key, n.n)
+		n = n.children[idx]
+	}
+	idx, exact := find(n.keys, key, n.n)
+	if !exact {
+		return nil
+	}
+	return n.values[idx]
+}
+
+// Scan calls fn on each key in [lo, hi) in order until fn returns false,
+// all from the root loaded when it starts.
+func (c *COWBPTree) Scan(lo, hi adt.Key, fn func(key adt.Key, value interface{}) bool) {
+	if n := c.load().root; n != nil {
+		scan(n, lo, hi, fn)
+	}
+}
+
+// scan reports whether to go on after the subtree n.
+func scan(n *node, lo, hi adt.Key, fn func(key adt.Key, value interface{}) bool) bool {
+	idx, _ := find(n.keys, lo, n.n)
+	if n.leaf {
+		for ; idx < n.n; idx++ {
+			if !n.keys[idx].Less(hi) || !fn(n.keys[idx], n.values[idx]) {
+				return false
+			}
+		}
+		return true
+	}
+	for ; idx <= n.n; idx++ {
+		if !scan(n.children[idx], lo, hi, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *COWBPTree) Length() int {
+	return c.load().length
+}
+
+func (c *COWBPTree) Insert(key adt.Key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &c.t
+	t.track(key)
+	defer c.publish()
+	if t.root == nil {
+		t.root = newNode(true, t.order)
+		t.root.leafInsert(key, value)
+		t.length++
+		return
+	}
+	path, idxs := c.clonePath(key)
+	// rightmost are whether the nodes on the path are the rightmost of their levels.
+	rightmost := make([]bool, len(path))
+	rightmost[0] = true
+	for i, idx := range idxs {
+		rightmost[i+1] = rightmost[i] && idx == path[i].n
+	}
+	n := path[len(path)-1]
+	split, lastKey, added := t.insertLeaf(n, key, value, t.biased(rightmost[len(path)-1]))
+	if split != nil {
+		// Keep leaves unlinked.
+		n.next, split.prev = nil, nil
+	}
+	if added {
+		t.length++
+	}
+	for i := len(path) - 2; i >= 0; i-- {
+		n, idx := path[i], idxs[i]
+		if split == nil {
+			if added {
+				n.counts.add(1, idx, n.n+1)
+			}
+			continue
+		}
+		n.recount(idx)
+		split, lastKey = t.insertInternal(n, lastKey, split, t.biased(rightmost[i]))
+	}
+	if split != nil {
+		root := newNode(false, t.order)
+		root.children[0] = t.root
+		root.recount(0)
+		root.internalInsert(lastKey, split)
+		t.root = root
+	}
+}
+
+// clonePath clones the nodes from the root to the leaf of key, and returns them and the index of
+// the child taken in each internal node.
+func (c *COWBPTree) clonePath(key adt.Key) ([]*node, []int) {
+	t := &c.t
+	t.root = t.root.clone()
+	path := []*node{t.root}
+	var idxs []int
+	for n := t.root; !n.leaf; {
+		idx, _ := find(n.keys, key, n.n)
+		n.children[idx] = n.children[idx].clone()
+		n = n.children[idx]
+		path = append(path, n)
+		idxs = append(idxs, idx)
+	}
+	return path, idxs
+}
+
+func (c *COWBPTree) Delete(key adt.Key) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &c.t
+	if cur := t.Seek(key); !cur.Valid() || !cur.Key().Equal(key) {
+		return nil
+	}
+	defer c.publish()
+	path, idxs := c.clonePath(key)
+	var deleted interface{}
+	path[len(path)-1].leafDelete(key, &deleted)
+	t.length--
+	underflow := path[len(path)-1].underflow()
+	for i := len(path) - 2; i >= 0; i-- {
+		n, idx := path[i], idxs[i]
+		n.counts.add(-1, idx, n.n+1)
+		if !underflow {
+			continue
+		}
+		last := idx == n.n
+		sibling := idx + 1
+		if last {
+			idx--
+			sibling = idx
+		}
+		// Clone the sibling which underflow modifies, the child is cloned already.
+		n.children[sibling] = n.children[sibling].clone()
+		underflow = t.underflow(n, idx, last)
+	}
+	if t.root.n == 0 {
+		t.root = t.root.children[0]
+	}
+	return deleted
+}
+
+func (c *COWBPTree) String() string {
+	return adt.PrintMultiWayTree(c.load().root)
+}
+
+// Validate checks the published tree like BPTree.Validate but the leaf chain.
+func (c *COWBPTree) Validate() bool {
+	p := c.load()
+	t := &BPTree{root: p.root, order: c.t.order, length: p.length, policy: c.t.policy}
+	return t.propertySameHeight() && t.propertyHalfFull(t.root, true) && t.propertyCounts()
+}
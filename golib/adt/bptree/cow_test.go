@@ -0,0 +1,190 @@
+package bptree_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/bptree"
+)
+
+func TestCOWBPTree(t *testing.T) {
+	adt.XTestADT(t, NewCOW(WithOrder(4)))
+}
+
+func TestCOWBPTreeModel(t *testing.T) {
+	for _, p := range splitPolicies {
+		for _, order := range []int{4, 5, 16} {
+			tree := NewCOW(append([]Option{WithOrder(order)}, p.opts...)...)
+			model := make(map[key]int)
+			for i := 0; i < 3000; i++ {
+				k := key(rand.Intn(1000))
+				if i%3 == 0 {
+					// Runs of appends exercise the biased splits.
+					k = key(1000 + i)
+				}
+				if rand.Intn(3) == 0 {
+					v := tree.Delete(k)
+					if expected, ok := model[k]; ok != (v != nil) || ok && v != expected {
+						t.Fatalf("Delete: key %v, expected %v, actual %v", k, expected, v)
+					}
+					delete(model, k)
+				} else {
+					tree.Insert(k, i)
+					model[k] = i
+				}
+				if i%50 != 0 {
+					continue
+				}
+				if !tree.Validate() || tree.Length() != len(model) {
+					t.Fatalf("Validate: %v, broken tree of order %v, length %v, expected %v\n%v", p.name, order, tree.Length(), len(model), tree)
+				}
+				num := 0
+				prev := key(-1)
+				tree.Scan(key(0), key(1<<30), func(k adt.Key, v interface{}) bool {
+					if k.(key) <= prev || model[k.(key)] != v {
+						t.Fatalf("Scan: key %v after %v, expected %v, actual %v", k, prev, model[k.(key)], v)
+					}
+					prev = k.(key)
+					num++
+					return true
+				})
+				if num != len(model) {
+					t.Fatalf("Scan: expected %v keys, actual %v", len(model), num)
+				}
+			}
+		}
+	}
+}
+
+// TestCOWBPTreeReaders runs readers against a writer, run it with -race.
+func TestCOWBPTreeReaders(t *testing.T) {
+	tree := NewCOW(WithOrder(5))
+	const keys = 2000
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k := key(rand.Intn(keys))
+				if v := tree.Search(k); v != nil && v != int(k) {
+					t.Errorf("Search: key %v, expected %v, actual %v", k, int(k), v)
+				}
+				prev := key(-1)
+				tree.Scan(k, k+100, func(k adt.Key, v interface{}) bool {
+					if k.(key) <= prev || v != int(k.(key)) {
+						t.Errorf("Scan: key %v after %v, actual %v", k, prev, v)
+						return false
+					}
+					prev = k.(key)
+					return true
+				})
+			}
+		}()
+	}
+	for i := 0; i < 20000; i++ {
+		k := key(rand.Intn(keys))
+		if rand.Intn(3) == 0 {
+			tree.Delete(k)
+		} else {
+			tree.Insert(k, int(k))
+		}
+	}
+	close(done)
+	readers.Wait()
+	if !tree.Validate() {
+		t.Fatalf("Validate: broken tree\n%v", tree)
+	}
+}
+
+func BenchmarkCOWBPTreeSearch(b *testing.B) {
+	adt.XBenchSearch(b, func() adt.ADT { return NewCOW(WithOrder(11)) })
+}
+
+func BenchmarkCOWBPTreeInsert(b *testing.B) {
+	adt.XBenchInsert(b, func() adt.ADT { return NewCOW(WithOrder(11)) })
+}
+
+// lockedBPTree is a BPTree behind a RWMutex, as the baseline of concurrent readers.
+type lockedBPTree struct {
+	mu sync.RWMutex
+	t  *BPTree
+}
+
+func (l *lockedBPTree) Insert(key adt.Key, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.t.Insert(key, value)
+}
+
+func (l *lockedBPTree) Search(key adt.Key) interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.t.Search(key)
+}
+
+func (l *lockedBPTree) Delete(key adt.Key) interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.t.Delete(key)
+}
+
+func (l *lockedBPTree) Length() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.t.Length()
+}
+
+// BenchmarkCOWBPTreeReaders searches in parallel while a writer keeps inserting.
+func BenchmarkCOWBPTreeReaders(b *testing.B) {
+	const keys = 100000
+	for _, c := range []struct {
+		name string
+		new  func() adt.ADT
+	}{
+		{"cow", func() adt.ADT { return NewCOW(WithOrder(64)) }},
+		{"latched", func() adt.ADT { return NewConcurrent(WithOrder(64)) }},
+		{"rwmutex", func() adt.ADT { return &lockedBPTree{t: New(WithOrder(64))} }},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			tree := c.new()
+			for i := 0; i < keys; i++ {
+				tree.Insert(key(i), i)
+			}
+			done := make(chan struct{})
+			var writer sync.WaitGroup
+			writer.Add(1)
+			go func() {
+				defer writer.Done()
+				r := rand.New(rand.NewSource(1))
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					k := key(r.Intn(keys))
+					tree.Insert(k, int(k))
+				}
+			}()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					tree.Search(key(r.Intn(keys)))
+				}
+			})
+			b.StopTimer()
+			close(done)
+			writer.Wait()
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package bptree
+
+import (
+	"github.com/atriw/lib/golib/adt"
+)
+
+// Cursor walks the entries of BPTree in key order along the leaf chain, in both directions.
+// Modifying the tree invalidates its cursors.
+type Cursor struct {
+	n   *node
+	idx int
+}
+
+// Valid reports whether the cursor is at an entry.
+func (c *Cursor) Valid() bool {
+	return c.n != nil
+}
+
+// Key returns the key of the current entry, it panics if c is not valid.
+func (c *Cursor) Key() adt.Key {
+	c.mustValid()
+	return c.n.keys[c.idx]
+}
+
+// Value returns the value of the current entry, it panics if c is not valid.
+func (c *Cursor) Value() interface{} {
+	c.mustValid()
+	return c.n.values[c.idx]
+}
+
+// Next moves to the next entry, and reports whether c is still valid.
+func (c *Cursor) Next() bool {
+	c.mustValid()
+	c.idx++
+	if c.idx == c.n.n {
+		c.n, c.idx = c.n.nextLeaf(), 0
+	}
+	return c.Valid()
+}
+
+// Prev moves to the previous entry, and reports whether c is still valid.
+func (c *Cursor) Prev() bool {
+	c.mustValid()
+	c.idx--
+	if c.idx < 0 {
+		c.n = c.n.prevLeaf()
+		if c.n != nil {
+			c.idx = c.n.n - 1
+		}
+	}
+	return c.Valid()
+}
+
+func (c *Cursor) mustValid() {
+	if !c.Valid() {
+		panic("invalid cursor")
+	}
+}
+
+// First returns a cursor at the min key, which is not valid if the tree is empty.
+func (t *BPTree) First() *Cursor {
+	if t.root == nil {
+		return &Cursor{}
+	}
+	return &Cursor{n: t.root.leftmostLeaf()}
+}
+
+// Last returns a cursor at the max key, which is not valid if the tree is empty.
+func (t *BPTree) Last() *Cursor {
+	if t.root == nil {
+		return &Cursor{}
+	}
+	n := t.root.rightmostLeaf()
+	return &Cursor{n: n, idx: n.n - 1}
+}
+
+// Seek returns a cursor at the first key not less than key, which is not valid if there is none.
+func (t *BPTree) Seek(key adt.Key) *Cursor {
+	n := t.root
+	if n == nil {
+		return &Cursor{}
+	}
+	for !n.leaf {
+		idx, _ := find(n.keys, key, n.n)
+		n = n.child(idx)
+	}
+	idx, _ := find(n.keys, key, n.n)
+	if idx == n.n {
+		// The next leaf starts with a key greater than key.
+		return &Cursor{n: n.nextLeaf()}
+	}
+	return &Cursor{n: n, idx: idx}
+}
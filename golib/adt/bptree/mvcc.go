@@ -0,0 +1,308 @@
+package bptree
+
+import (
+	"sync"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+// MVCCBPTree is a multi-version BPTree safe for concurrent use, whose snapshots are consistent
+// point-in-time views while writers keep going.
+//
+// Each write gets the next commit timestamp, and prepends a version to the chain of its key,
+// which is the value in the underlying BPTree. A delete prepends a tombstone.
+// Versions are never overwritten, so GC drops those no snapshot can see.
+type MVCCBPTree struct {
+	mu sync.RWMutex
+	t  BPTree
+	// ts is the last commit timestamp.
+	ts uint64
+	// snapshots are the numbers of open snapshots by their timestamps.
+	snapshots map[uint64]int
+	// length is the number of keys at ts, and versions is the number of versions of all keys.
+	length   int
+	versions int
+	// gcKey is where the next GCStep starts, nil for the first key.
+	gcKey adt.Key
+}
+
+const (
+	// gcBatch is the number of keys GC visits per write lock.
+	gcBatch = 256
+	// scanBatch is the number of entries Snapshot.Scan reads per read lock.
+	scanBatch = 64
+)
+
+// version is a committed value of a key, linking to the previous one.
+type version struct {
+	ts      uint64
+	value   interface{}
+	deleted bool
+	prev    *version
+}
+
+// at returns the latest version committed at or before ts, or nil if there is none.
+func (v *version) at(ts uint64) *version {
+	for v != nil && v.ts > ts {
+		v = v.prev
+	}
+	return v
+}
+
+func NewMVCC(opts ...Option) *MVCCBPTree {
+	return &MVCCBPTree{t: *New(opts...), snapshots: make(map[uint64]int)}
+}
+
+func (m *MVCCBPTree) Insert(key adt.Key, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	head, _ := m.t.Search(key).(*version)
+	if head == nil || head.deleted {
+		m.length++
+	}
+	m.ts++
+	m.versions++
+	m.t.Insert(key, &version{ts: m.ts, value: value, prev: head})
+}
+
+// Delete commits a tombstone if key exists, and returns its value.
+func (m *MVCCBPTree) Delete(key adt.Key) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	head, _ := m.t.Search(key).(*version)
+	if head == nil || head.deleted {
+		return nil
+	}
+	m.length--
+	m.ts++
+	m.versions++
+	m.t.Insert(key, &version{ts: m.ts, deleted: true, prev: head})
+	return head.value
+}
+
+// Search returns the latest value of key.
+func (m *MVCCBPTree) Search(key adt.Key) interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.search(key, m.ts)
+}
+
+func (m *MVCCBPTree) search(key adt.Key, ts uint64) interface{} {
+	head, _ := m.t.Search(key).(*version)
+	v := head.at(ts)
+	if v == nil || v.deleted {
+		return nil
+	}
+	return v.value
+}
+
+// Length returns the number of keys at the last commit.
+func (m *MVCCBPTree) Length() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.length
+}
+
+// Timestamp returns the last commit timestamp.
+func (m *MVCCBPTree) Timestamp() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ts
+}
+
+// Versions returns the number of versions kept, including tombstones.
+func (m *MVCCBPTree) Versions() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.versions
+}
+
+// Snapshot returns a read-only view at the last commit, which must be closed to let GC drop the versions it sees.
+func (m *MVCCBPTree) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots[m.ts]++
+	return &Snapshot{m: m, ts: m.ts}
+}
+
+// GC drops the versions older than the oldest open snapshot, or the last commit if there is none,
+// and the keys deleted by then. It returns the number of dropped versions.
+// It walks all keys in batches, and releases the write lock between them to let writers and snapshots go on.
+func (m *MVCCBPTree) GC() int {
+	dropped := 0
+	for from := adt.Key(nil); ; {
+		n, next := m.gc(from, gcBatch)
+		dropped += n
+		if next == nil {
+			return dropped
+		}
+		from = next
+	}
+}
+
+// GCStep incrementally does what GC does, starting where the last call stopped, until it visits budget keys.
+// It returns the number of dropped versions, and whether it reached the last key, and then the next call
+// starts over from the first. The tree may be modified between calls.
+func (m *MVCCBPTree) GCStep(budget int) (int, bool) {
+	m.mu.Lock()
+	from := m.gcKey
+	m.mu.Unlock()
+	dropped, next := m.gc(from, budget)
+	m.mu.Lock()
+	m.gcKey = next
+	m.mu.Unlock()
+	return dropped, next == nil
+}
+
+// gc drops versions as GC does for at most budget keys from key from on, a nil from means the first key,
+// under the write lock. It returns the number of dropped versions and the key to go on from,
+// nil if it reached the last key.
+func (m *MVCCBPTree) gc(from adt.Key, budget int) (int, adt.Key) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	horizon := m.ts
+	for ts := range m.snapshots {
+		if ts < horizon {
+			horizon = ts
+		}
+	}
+	c := m.t.First()
+	if from != nil {
+		c = m.t.Seek(from)
+	}
+	dropped := 0
+	var deleted []adt.Key
+	for ; c.Valid() && budget > 0; c.Next() {
+		budget--
+		head := c.Value().(*version)
+		// v is the oldest version to keep, and newer is the one after it.
+		var newer *version
+		v := head
+		for v != nil && v.ts > horizon {
+			newer, v = v, v.prev
+		}
+		if v == nil {
+			continue
+		}
+		// A tombstone reads the same as no version.
+		if !v.deleted {
+			newer, v = v, v.prev
+		}
+		for ; v != nil; v = v.prev {
+			dropped++
+		}
+		if newer == nil {
+			deleted = append(deleted, c.Key())
+		} else {
+			newer.prev = nil
+		}
+	}
+	var next adt.Key
+	if c.Valid() {
+		next = c.Key()
+	}
+	for _, key := range deleted {
+		m.t.Delete(key)
+	}
+	m.versions -= dropped
+	return dropped, next
+}
+
+func (m *MVCCBPTree) String() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.t.String()
+}
+
+// Validate checks the underlying tree, that version chains go back in time, and the counters.
+func (m *MVCCBPTree) Validate() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	length, versions := 0, 0
+	for c := m.t.First(); c.Valid(); c.Next() {
+		head := c.Value().(*version)
+		if !head.deleted {
+			length++
+		}
+		for v := head; v != nil; v = v.prev {
+			if v.ts > m.ts || v.prev != nil && v.prev.ts >= v.ts {
+				return false
+			}
+			versions++
+		}
+	}
+	return m.t.Validate() && length == m.length && versions == m.versions
+}
+
+// Snapshot is a read-only view of MVCCBPTree at a timestamp, safe for concurrent use.
+type Snapshot struct {
+	m      *MVCCBPTree
+	ts     uint64
+	closed bool
+}
+
+// Timestamp returns the commit timestamp the snapshot sees.
+func (s *Snapshot) Timestamp() uint64 {
+	return s.ts
+}
+
+// Search returns the value of key at the snapshot.
+func (s *Snapshot) Search(key adt.Key) interface{} {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+	s.mustOpen()
+	return s.m.search(key, s.ts)
+}
+
+// Scan calls fn on each key in [lo, hi) at the snapshot in order until fn returns false.
+// It reads scanBatch entries at a time under the read lock, and calls fn on them without the lock,
+// so fn may write to the tree.
+func (s *Snapshot) Scan(lo, hi adt.Key, fn func(key adt.Key, value interface{}) bool) {
+	keys := make([]adt.Key, 0, scanBatch)
+	values := make([]interface{}, 0, scanBatch)
+	for from := lo; from != nil; {
+		keys, values, from = s.scan(from, hi, keys[:0], values[:0])
+		for i, k := range keys {
+			if !fn(k, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// scan appends the entries in [from, hi) at the snapshot to keys and values until they are full,
+// and returns them with the key to go on from, nil if there are no more.
+func (s *Snapshot) scan(from, hi adt.Key, keys []adt.Key, values []interface{}) ([]adt.Key, []interface{}, adt.Key) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+	s.mustOpen()
+	for c := s.m.t.Seek(from); c.Valid() && c.Key().Less(hi); c.Next() {
+		if len(keys) == cap(keys) {
+			return keys, values, c.Key()
+		}
+		v := c.Value().(*version).at(s.ts)
+		if v == nil || v.deleted {
+			continue
+		}
+		keys = append(keys, c.Key())
+		values = append(values, v.value)
+	}
+	return keys, values, nil
+}
+
+// Close releases the snapshot, and it panics if closed twice.
+func (s *Snapshot) Close() {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	s.mustOpen()
+	s.closed = true
+	if s.m.snapshots[s.ts]--; s.m.snapshots[s.ts] == 0 {
+		delete(s.m.snapshots, s.ts)
+	}
+}
+
+func (s *Snapshot) mustOpen() {
+	if s.closed {
+		panic("closed snapshot")
+	}
+}
@@ -0,0 +1,218 @@
+package bptree_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/bptree"
+)
+
+func TestMVCCBPTree(t *testing.T) {
+	adt.XTestADT(t, NewMVCC(WithOrder(4)))
+}
+
+// scanned returns the entries of s in [lo, hi) as a model.
+func scanned(s *Snapshot, lo, hi key) map[key]int {
+	m := make(map[key]int)
+	s.Scan(lo, hi, func(k adt.Key, v interface{}) bool {
+		m[k.(key)] = v.(int)
+		return true
+	})
+	return m
+}
+
+func TestMVCCBPTreeSnapshot(t *testing.T) {
+	tree := NewMVCC(WithOrder(4))
+	model := make(map[key]int)
+	var snapshots []*Snapshot
+	var models []map[key]int
+	for i := 0; i < 3000; i++ {
+		k := key(rand.Intn(300))
+		if rand.Intn(3) == 0 {
+			tree.Delete(k)
+			delete(model, k)
+		} else {
+			tree.Insert(k, i)
+			model[k] = i
+		}
+		if i%100 == 0 {
+			m := make(map[key]int)
+			for k, v := range model {
+				m[k] = v
+			}
+			snapshots = append(snapshots, tree.Snapshot())
+			models = append(models, m)
+		}
+		if i%300 == 0 && len(snapshots) > 2 {
+			// Close the oldest snapshot and a random one, then GC.
+			for _, j := range []int{0, rand.Intn(len(snapshots) - 1)} {
+				snapshots[j].Close()
+				snapshots = append(snapshots[:j], snapshots[j+1:]...)
+				models = append(models[:j], models[j+1:]...)
+			}
+			tree.GC()
+			if !tree.Validate() {
+				t.Fatalf("Validate: broken tree\n%v", tree)
+			}
+		}
+	}
+	if tree.Length() != len(model) {
+		t.Fatalf("Length: expected %v, actual %v", len(model), tree.Length())
+	}
+	for i, s := range snapshots {
+		if actual := scanned(s, 0, 300); fmt.Sprint(actual) != fmt.Sprint(models[i]) {
+			t.Fatalf("Scan: snapshot at %v, expected %v, actual %v", s.Timestamp(), models[i], actual)
+		}
+		for k := key(0); k < 300; k++ {
+			v, ok := models[i][k]
+			if actual := s.Search(k); ok != (actual != nil) || ok && actual != v {
+				t.Fatalf("Search: snapshot at %v, key %v, expected %v, actual %v", s.Timestamp(), k, v, actual)
+			}
+		}
+		s.Close()
+	}
+	tree.GC()
+	if !tree.Validate() {
+		t.Fatalf("Validate: broken tree\n%v", tree)
+	}
+	if tree.Versions() != len(model) {
+		t.Errorf("GC: expected a version per key, actual %v versions of %v keys", tree.Versions(), len(model))
+	}
+	for k, v := range model {
+		if actual := tree.Search(k); actual != v {
+			t.Fatalf("Search: key %v, expected %v, actual %v", k, v, actual)
+		}
+	}
+}
+
+func TestMVCCBPTreeGC(t *testing.T) {
+	tree := NewMVCC(WithOrder(4))
+	tree.Insert(key(1), 1)
+	tree.Insert(key(2), 2)
+	s := tree.Snapshot()
+	tree.Insert(key(1), 10)
+	tree.Delete(key(2))
+	tree.Insert(key(1), 100)
+	// The snapshot still needs 1 and 2.
+	if dropped := tree.GC(); dropped != 0 {
+		t.Errorf("GC: expected 0 dropped, actual %v", dropped)
+	}
+	if v := s.Search(key(2)); v != 2 {
+		t.Errorf("Search: expected 2, actual %v", v)
+	}
+	s.Close()
+	// Versions 1 and 10 of key 1, and both versions of key 2.
+	if dropped := tree.GC(); dropped != 4 {
+		t.Errorf("GC: expected 4 dropped, actual %v", dropped)
+	}
+	if tree.Versions() != 1 || tree.Length() != 1 || tree.Search(key(1)) != 100 {
+		t.Errorf("GC: expected only key 1 at 100, actual %v", tree)
+	}
+}
+
+func TestMVCCBPTreeGCStep(t *testing.T) {
+	tree := NewMVCC(WithOrder(4))
+	for i := 0; i < 300; i++ {
+		tree.Insert(key(i%100), i)
+	}
+	for k := key(0); k < 100; k += 2 {
+		tree.Delete(k)
+	}
+	// Each key has 3 versions, and the even keys have a tombstone and are dropped.
+	dropped, steps := 0, 0
+	for done := false; !done; steps++ {
+		var n int
+		n, done = tree.GCStep(7)
+		dropped += n
+		if !tree.Validate() {
+			t.Fatalf("Validate: broken tree\n%v", tree)
+		}
+	}
+	if steps != 15 || dropped != 50*2+50*4 {
+		t.Errorf("GCStep: expected 300 dropped in 15 steps, actual %v in %v steps", dropped, steps)
+	}
+	if tree.Versions() != 50 || tree.Length() != 50 {
+		t.Errorf("GCStep: expected 50 versions of 50 keys, actual %v versions of %v keys", tree.Versions(), tree.Length())
+	}
+	if n, done := tree.GCStep(1000); n != 0 || !done {
+		t.Errorf("GCStep: expected nothing to drop, actual %v dropped", n)
+	}
+}
+
+func TestMVCCBPTreeScanWrite(t *testing.T) {
+	tree := NewMVCC(WithOrder(4))
+	for k := key(0); k < 200; k++ {
+		tree.Insert(k, int(k))
+	}
+	s := tree.Snapshot()
+	defer s.Close()
+	// Writing in fn would deadlock if the scan held the lock.
+	n := 0
+	s.Scan(key(0), key(200), func(k adt.Key, v interface{}) bool {
+		if v != int(k.(key)) {
+			t.Fatalf("Scan: key %v, expected %v, actual %v", k, k, v)
+		}
+		tree.Delete(k)
+		tree.Insert(k.(key)+200, 0)
+		n++
+		return true
+	})
+	if n != 200 || tree.Length() != 200 || tree.Search(key(0)) != nil {
+		t.Errorf("Scan: expected 200 keys moved, actual %v scanned and %v keys", n, tree.Length())
+	}
+}
+
+// TestMVCCBPTreeConcurrent scans snapshots twice while a writer keeps going, run it with -race.
+func TestMVCCBPTreeConcurrent(t *testing.T) {
+	tree := NewMVCC(WithOrder(8))
+	const keys = 500
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20000; i++ {
+			// Each value is the commit timestamp of its write.
+			if k := key(rand.Intn(keys)); rand.Intn(4) == 0 {
+				tree.Delete(k)
+			} else {
+				tree.Insert(k, int(tree.Timestamp())+1)
+			}
+			if i%1000 == 0 {
+				tree.GC()
+			}
+		}
+		close(done)
+	}()
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := tree.Snapshot()
+				first := scanned(s, 0, keys)
+				for k, v := range first {
+					if uint64(v) > s.Timestamp() {
+						t.Errorf("Scan: snapshot at %v sees key %v at %v", s.Timestamp(), k, v)
+					}
+				}
+				if second := scanned(s, 0, keys); fmt.Sprint(first) != fmt.Sprint(second) {
+					t.Errorf("Scan: snapshot at %v changed", s.Timestamp())
+				}
+				s.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if !tree.Validate() {
+		t.Fatalf("Validate: broken tree\n%v", tree)
+	}
+}
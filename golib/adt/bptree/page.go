@@ -0,0 +1,157 @@
+package bptree
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// A node page of PagedBPTree is
+//
+//   kind(1) | n(2) | prev(8) | next(8) | slots
+//
+// where n is the number of keys, and prev, next link leaves.
+// A leaf slot is key length(2) | key | value length(2) | value.
+// Internal slots are child 0(8) | count 0(8), then key length(2) | key | child(8) | count(8) for each key,
+// where counts are the cumulative counts of the node.
+// A freed page is kindFree(1) | next freed page(8).
+// All integers are little endian.
+
+const (
+	kindLeaf     byte = 1
+	kindInternal byte = 2
+	kindFree     byte = 3
+
+	headerSize = 19
+)
+
+// Bytes is a byte-string key, the key type of PagedBPTree.
+type Bytes []byte
+
+func (b Bytes) Less(other interface{}) bool {
+	o, ok := other.(Bytes)
+	return ok && bytes.Compare(b, o) < 0
+}
+
+func (b Bytes) Equal(other interface{}) bool {
+	o, ok := other.(Bytes)
+	return ok && bytes.Equal(b, o)
+}
+
+// leafOrder and internalOrder return the max numbers of keys of a leaf and children of an internal node
+// that fit in a page.
+func leafOrder(pageSize, maxKeySize, maxValueSize int) int {
+	return (pageSize - headerSize) / (4 + maxKeySize + maxValueSize)
+}
+
+func internalOrder(pageSize, maxKeySize int) int {
+	return (pageSize-headerSize-16)/(18+maxKeySize) + 1
+}
+
+// encode writes the loaded node n to the page buf.
+func encode(n *node, buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	buf[0] = kindInternal
+	if n.leaf {
+		buf[0] = kindLeaf
+	}
+	binary.LittleEndian.PutUint16(buf[1:], uint16(n.n))
+	binary.LittleEndian.PutUint64(buf[3:], n.prev.pageID())
+	binary.LittleEndian.PutUint64(buf[11:], n.next.pageID())
+	p := buf[headerSize:]
+	putBytes := func(b []byte) {
+		binary.LittleEndian.PutUint16(p, uint16(len(b)))
+		copy(p[2:], b)
+		p = p[2+len(b):]
+	}
+	putUint64 := func(x uint64) {
+		binary.LittleEndian.PutUint64(p, x)
+		p = p[8:]
+	}
+	if n.leaf {
+		for i := 0; i < n.n; i++ {
+			putBytes(n.keys[i].(Bytes))
+			putBytes(n.values[i].([]byte))
+		}
+		return
+	}
+	putUint64(n.children[0].id)
+	putUint64(uint64(n.counts[0]))
+	for i := 0; i < n.n; i++ {
+		putBytes(n.keys[i].(Bytes))
+		putUint64(n.children[i+1].id)
+		putUint64(uint64(n.counts[i+1]))
+	}
+}
+
+// pageID returns the id of n, or 0 if n is nil.
+func (n *node) pageID() uint64 {
+	if n == nil {
+		return 0
+	}
+	return n.id
+}
+
+// decode fills the stub n of order from the page buf, with stub returning the node of a page id, or nil for 0.
+func decode(n *node, buf []byte, order int, stub func(id uint64) *node) error {
+	kind := buf[0]
+	num := int(binary.LittleEndian.Uint16(buf[1:]))
+	if kind != kindLeaf && kind != kindInternal || num > order || kind == kindInternal && num >= order {
+		return ErrCorrupted
+	}
+	id := n.id
+	*n = *newNode(kind == kindLeaf, order)
+	n.id, n.n = id, num
+	n.prev = stub(binary.LittleEndian.Uint64(buf[3:]))
+	n.next = stub(binary.LittleEndian.Uint64(buf[11:]))
+	p := buf[headerSize:]
+	corrupted := false
+	getBytes := func() []byte {
+		if len(p) < 2 {
+			corrupted = true
+			return nil
+		}
+		l := int(binary.LittleEndian.Uint16(p))
+		if len(p) < 2+l {
+			corrupted = true
+			return nil
+		}
+		b := append(make([]byte, 0, l), p[2:2+l]...)
+		p = p[2+l:]
+		return b
+	}
+	getUint64 := func() uint64 {
+		if len(p) < 8 {
+			corrupted = true
+			return 0
+		}
+		x := binary.LittleEndian.Uint64(p)
+		p = p[8:]
+		return x
+	}
+	getChild := func(i int) {
+		if id := getUint64(); id != 0 {
+			n.children[i] = stub(id)
+		} else {
+			corrupted = true
+		}
+		n.counts[i] = int(getUint64())
+	}
+	if n.leaf {
+		for i := 0; i < num && !corrupted; i++ {
+			n.keys[i] = Bytes(getBytes())
+			n.values[i] = getBytes()
+		}
+	} else {
+		getChild(0)
+		for i := 0; i < num && !corrupted; i++ {
+			n.keys[i] = Bytes(getBytes())
+			getChild(i + 1)
+		}
+	}
+	if corrupted {
+		return ErrCorrupted
+	}
+	return nil
+}
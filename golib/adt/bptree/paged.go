@@ -0,0 +1,507 @@
+package bptree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+var (
+	// ErrClosed is returned by operations on a closed PagedBPTree
+	ErrClosed = errors.New("bptree: closed")
+	// ErrCorrupted is returned if the file is not a valid PagedBPTree
+	ErrCorrupted = errors.New("bptree: corrupted file")
+	// ErrTooLarge is returned if a key or value exceeds the max size
+	ErrTooLarge = errors.New("bptree: key or value too large")
+)
+
+const (
+	defaultPageSize     = 4096
+	defaultMaxKeySize   = 64
+	defaultMaxValueSize = 128
+	defaultFrames       = 64
+
+	metaMagic = 0x7062747265650002
+	metaSize  = 48
+	// minOrder is the min order New accepts.
+	minOrder = 4
+)
+
+// PagedBPTree is a BPTree of Bytes keys and []byte values stored in fixed-size pages of a local file,
+// not safe for concurrent use.
+//
+// It runs BPTree over nodes decoded from pages of an LRU buffer pool. An operation decodes the nodes it reaches
+// and keeps their pages pinned. If it succeeds, it encodes the nodes back into their pages and links the pages
+// of freed nodes into the free list, all in the buffer pool. If it fails with an I/O error or a corrupted page,
+// it changes nothing, so the tree stays usable.
+// Key and value sizes are bounded, so that the order follows from the page size.
+//
+// There is no write-ahead log, the file is consistent only after Sync or Close.
+type PagedBPTree struct {
+	t     BPTree
+	pager *pager
+	pool  *bufferPool
+	// root is the page of the root, 0 if the tree is empty.
+	root uint64
+
+	pageSize     int
+	maxKeySize   int
+	maxValueSize int
+	frames       int
+	opts         []Option
+
+	closed bool
+}
+
+// PagedOption is PagedBPTree initialization options
+type PagedOption func(*PagedBPTree)
+
+// WithPageSize sets the page size of a new file, an existing file keeps its page size
+func WithPageSize(size int) PagedOption {
+	return func(t *PagedBPTree) {
+		t.pageSize = size
+	}
+}
+
+// WithMaxKeySize sets the max key size of a new file, an existing file keeps its max key size
+func WithMaxKeySize(size int) PagedOption {
+	return func(t *PagedBPTree) {
+		t.maxKeySize = size
+	}
+}
+
+// WithMaxValueSize sets the max value size of a new file, an existing file keeps its max value size
+func WithMaxValueSize(size int) PagedOption {
+	return func(t *PagedBPTree) {
+		t.maxValueSize = size
+	}
+}
+
+// WithFrames sets the number of pages cached by the buffer pool.
+// The pages pinned by an operation may outnumber it until the operation returns.
+func WithFrames(n int) PagedOption {
+	return func(t *PagedBPTree) {
+		t.frames = n
+	}
+}
+
+// WithTreeOptions sets the options of the BPTree, but the order, which follows from the page size.
+func WithTreeOptions(opts ...Option) PagedOption {
+	return func(t *PagedBPTree) {
+		t.opts = append(t.opts, opts...)
+	}
+}
+
+// OpenPaged opens the tree in the file path, creating it if not exists
+func OpenPaged(path string, opts ...PagedOption) (*PagedBPTree, error) {
+	t := &PagedBPTree{
+		pageSize:     defaultPageSize,
+		maxKeySize:   defaultMaxKeySize,
+		maxValueSize: defaultMaxValueSize,
+		frames:       defaultFrames,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.frames < 1 {
+		panic("frames should be at least 1")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	t.pager = &pager{f: f}
+	var length int
+	if length, err = t.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	order := leafOrder(t.pageSize, t.maxKeySize, t.maxValueSize)
+	if o := internalOrder(t.pageSize, t.maxKeySize); o < order {
+		order = o
+	}
+	if order < minOrder || t.pageSize < metaSize || t.maxKeySize > 0xffff || t.maxValueSize > 0xffff {
+		f.Close()
+		return nil, fmt.Errorf("bptree: page size %v too small for key size %v and value size %v", t.pageSize, t.maxKeySize, t.maxValueSize)
+	}
+	t.t = *New(append(t.opts, WithOrder(order))...)
+	t.t.length = length
+	t.pager.pageSize = t.pageSize
+	t.pool = newBufferPool(t.pager, t.frames)
+	return t, nil
+}
+
+// load reads the meta page, or initializes it if the file is empty, and returns the length.
+func (t *PagedBPTree) load() (int, error) {
+	fi, err := t.pager.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.Size() == 0 {
+		t.pager.count = 1
+		return 0, nil
+	}
+	var meta [metaSize]byte
+	if _, err := t.pager.f.ReadAt(meta[:], 0); err != nil {
+		return 0, ErrCorrupted
+	}
+	if binary.LittleEndian.Uint64(meta[0:]) != metaMagic {
+		return 0, ErrCorrupted
+	}
+	t.pageSize = int(binary.LittleEndian.Uint32(meta[8:]))
+	t.maxKeySize = int(binary.LittleEndian.Uint16(meta[12:]))
+	t.maxValueSize = int(binary.LittleEndian.Uint16(meta[14:]))
+	t.root = binary.LittleEndian.Uint64(meta[16:])
+	t.pager.freeHead = binary.LittleEndian.Uint64(meta[24:])
+	t.pager.count = binary.LittleEndian.Uint64(meta[32:])
+	if t.pageSize <= 0 || fi.Size() != int64(t.pager.count)*int64(t.pageSize) {
+		return 0, ErrCorrupted
+	}
+	return int(binary.LittleEndian.Uint64(meta[40:])), nil
+}
+
+// Sync writes back dirty pages and the meta page, and syncs the file.
+func (t *PagedBPTree) Sync() error {
+	if t.closed {
+		return ErrClosed
+	}
+	if err := t.pool.flush(); err != nil {
+		return err
+	}
+	meta := make([]byte, t.pageSize)
+	binary.LittleEndian.PutUint64(meta[0:], metaMagic)
+	binary.LittleEndian.PutUint32(meta[8:], uint32(t.pageSize))
+	binary.LittleEndian.PutUint16(meta[12:], uint16(t.maxKeySize))
+	binary.LittleEndian.PutUint16(meta[14:], uint16(t.maxValueSize))
+	binary.LittleEndian.PutUint64(meta[16:], t.root)
+	binary.LittleEndian.PutUint64(meta[24:], t.pager.freeHead)
+	binary.LittleEndian.PutUint64(meta[32:], t.pager.count)
+	binary.LittleEndian.PutUint64(meta[40:], uint64(t.t.length))
+	if err := t.pager.write(0, meta); err != nil {
+		return err
+	}
+	return t.pager.f.Sync()
+}
+
+// Close syncs and closes the file
+func (t *PagedBPTree) Close() error {
+	if err := t.Sync(); err != nil {
+		if err != ErrClosed {
+			t.pager.f.Close()
+			t.closed = true
+		}
+		return err
+	}
+	t.closed = true
+	return t.pager.f.Close()
+}
+
+// PoolStats returns the counters of the buffer pool
+func (t *PagedBPTree) PoolStats() PoolStats {
+	return t.pool.stats
+}
+
+// storeError carries an error of pagedStore out of BPTree, which has no error results.
+type storeError struct {
+	err error
+}
+
+// pagedStore is the store of an operation of PagedBPTree. It keeps one node per page the operation reaches,
+// and the pinned frames of the loaded and allocated nodes until it commits or aborts.
+type pagedStore struct {
+	t      *PagedBPTree
+	nodes  map[uint64]*node
+	frames map[uint64]*frame
+	// freed are the pages of freed nodes, which new nodes reuse first.
+	freed []uint64
+	// count is the number of pages before the operation, later pages are appended by it.
+	count uint64
+}
+
+// node returns the node of page id, a stub if not loaded yet, or nil for 0.
+func (s *pagedStore) node(id uint64) *node {
+	if id == 0 {
+		return nil
+	}
+	n, ok := s.nodes[id]
+	if !ok {
+		n = &node{id: id, stub: s}
+		s.nodes[id] = n
+	}
+	return n
+}
+
+func (s *pagedStore) load(n *node) {
+	f, err := s.t.pool.fetch(n.id)
+	if err != nil {
+		panic(storeError{err})
+	}
+	s.frames[n.id] = f
+	if err := decode(n, f.data, s.t.t.order, s.node); err != nil {
+		panic(storeError{fmt.Errorf("page %v: %w", n.id, err)})
+	}
+}
+
+func (s *pagedStore) alloc(n *node) {
+	if l := len(s.freed); l > 0 {
+		n.id, s.freed = s.freed[l-1], s.freed[:l-1]
+	} else {
+		f, err := s.t.pool.allocate()
+		if err != nil {
+			panic(storeError{err})
+		}
+		n.id = f.id
+		s.frames[n.id] = f
+	}
+	s.nodes[n.id] = n
+}
+
+func (s *pagedStore) free(n *node) {
+	n.load()
+	s.freed = append(s.freed, n.id)
+}
+
+// commit encodes the nodes into their frames, marking the changed ones dirty, links the pages of freed nodes
+// into the free list, and unpins the frames.
+func (s *pagedStore) commit() {
+	freed := make(map[uint64]bool, len(s.freed))
+	for _, id := range s.freed {
+		data := s.frames[id].data
+		for i := range data {
+			data[i] = 0
+		}
+		data[0] = kindFree
+		binary.LittleEndian.PutUint64(data[1:], s.t.pager.freeHead)
+		s.t.pager.freeHead = id
+		freed[id] = true
+	}
+	buf := make([]byte, s.t.pageSize)
+	for id, f := range s.frames {
+		dirty := freed[id]
+		if !dirty {
+			encode(s.nodes[id], buf)
+			if !bytes.Equal(buf, f.data) {
+				copy(f.data, buf)
+				dirty = true
+			}
+		}
+		s.t.pool.unpin(f, dirty)
+	}
+}
+
+// release unpins the frames of an operation which modifies nothing.
+func (s *pagedStore) release() {
+	for _, f := range s.frames {
+		s.t.pool.unpin(f, false)
+	}
+}
+
+// abort unpins the frames unchanged, and discards the frames of appended pages.
+func (s *pagedStore) abort() {
+	for _, f := range s.frames {
+		if f.id >= s.count {
+			s.t.pool.discard(f)
+		} else {
+			s.t.pool.unpin(f, false)
+		}
+	}
+}
+
+// run runs fn as an operation on the tree, and commits it if write.
+// If fn panics, it restores the tree and the pager as before the operation, and returns the error of the store,
+// or panics again with other values.
+func (t *PagedBPTree) run(write bool, fn func()) (err error) {
+	if t.closed {
+		return ErrClosed
+	}
+	if err := t.pool.trim(); err != nil {
+		return err
+	}
+	s := &pagedStore{t: t, nodes: make(map[uint64]*node), frames: make(map[uint64]*frame), count: t.pager.count}
+	saved, freeHead := t.t, t.pager.freeHead
+	t.t.store = s
+	defer func() {
+		// Drop the nodes of the operation.
+		t.t.root, t.t.store = nil, nil
+		r := recover()
+		if r == nil {
+			return
+		}
+		s.abort()
+		t.t, t.pager.count, t.pager.freeHead = saved, s.count, freeHead
+		e, ok := r.(storeError)
+		if !ok {
+			panic(r)
+		}
+		err = e.err
+	}()
+	t.t.root = s.node(t.root).load()
+	fn()
+	if !write {
+		s.release()
+		return nil
+	}
+	s.commit()
+	t.root = t.t.root.pageID()
+	return nil
+}
+
+// Get returns the value of key and whether it exists
+func (t *PagedBPTree) Get(key []byte) (value []byte, ok bool, err error) {
+	err = t.run(false, func() {
+		if v := t.t.Search(Bytes(key)); v != nil {
+			value, ok = v.([]byte), true
+		}
+	})
+	return value, ok, err
+}
+
+// Put sets the value of key
+func (t *PagedBPTree) Put(key, value []byte) error {
+	if t.closed {
+		return ErrClosed
+	}
+	if len(key) > t.maxKeySize || len(value) > t.maxValueSize {
+		return ErrTooLarge
+	}
+	k, v := Bytes(append([]byte(nil), key...)), append([]byte{}, value...)
+	return t.run(true, func() {
+		t.t.Insert(k, v)
+	})
+}
+
+// Remove deletes key, and returns its value and whether it existed
+func (t *PagedBPTree) Remove(key []byte) (value []byte, ok bool, err error) {
+	err = t.run(true, func() {
+		if v := t.t.Delete(Bytes(key)); v != nil {
+			value, ok = v.([]byte), true
+		}
+	})
+	return value, ok, err
+}
+
+// Scan calls fn on each key in [start, end) in order until fn returns false, a nil end means no upper bound.
+// It reads a leaf per operation, so fn may modify the tree, and then Scan goes on after the last key it returned.
+func (t *PagedBPTree) Scan(start, end []byte, fn func(key, value []byte) bool) error {
+	from := Bytes(start)
+	for {
+		var keys, values [][]byte
+		var next Bytes
+		err := t.run(false, func() {
+			c := t.t.Seek(from)
+			for n := c.n; c.Valid() && c.n == n; c.Next() {
+				key := c.Key().(Bytes)
+				if end != nil && bytes.Compare(key, end) >= 0 {
+					return
+				}
+				keys, values = append(keys, key), append(values, c.Value().([]byte))
+			}
+			if c.Valid() {
+				next = c.Key().(Bytes)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		for i := range keys {
+			if !fn(keys[i], values[i]) {
+				return nil
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		from = next
+	}
+}
+
+// CountRange is BPTree.CountRange.
+func (t *PagedBPTree) CountRange(lo, hi []byte) (num int, err error) {
+	err = t.run(false, func() {
+		num = t.t.CountRange(Bytes(lo), Bytes(hi))
+	})
+	return num, err
+}
+
+// DeleteRange removes all keys in [lo, hi), and returns the number of removed keys.
+func (t *PagedBPTree) DeleteRange(lo, hi []byte) (num int, err error) {
+	err = t.run(true, func() {
+		num, _ = t.t.DeleteRange(Bytes(lo), Bytes(hi), false)
+	})
+	return num, err
+}
+
+// Compact is BPTree.Compact, it reads and rewrites all pages in one operation.
+func (t *PagedBPTree) Compact(targetFill float64) (before, after Stats, err error) {
+	err = t.run(true, func() {
+		before, after = t.t.Compact(targetFill)
+	})
+	return before, after, err
+}
+
+// CompactStep is BPTree.CompactStep.
+func (t *PagedBPTree) CompactStep(targetFill float64, budget int) (before, after Stats, done bool, err error) {
+	err = t.run(true, func() {
+		before, after, done = t.t.CompactStep(targetFill, budget)
+	})
+	return before, after, done, err
+}
+
+// Stats returns the shape of the tree, reading all pages.
+func (t *PagedBPTree) Stats() (s Stats, err error) {
+	err = t.run(false, func() {
+		s = t.t.Stats()
+	})
+	return s, err
+}
+
+// Insert is Put for adt.ADT, key must be Bytes and value must be []byte.
+// It panics on errors.
+func (t *PagedBPTree) Insert(key adt.Key, value interface{}) {
+	if err := t.Put(key.(Bytes), value.([]byte)); err != nil {
+		panic(err)
+	}
+}
+
+// Search is Get for adt.ADT, key must be Bytes.
+// It returns nil if key does not exist, and panics on errors.
+func (t *PagedBPTree) Search(key adt.Key) interface{} {
+	v, ok, err := t.Get(key.(Bytes))
+	if err != nil {
+		panic(err)
+	}
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Delete is Remove for adt.ADT, key must be Bytes.
+// It returns nil if key does not exist, and panics on errors.
+func (t *PagedBPTree) Delete(key adt.Key) interface{} {
+	v, ok, err := t.Remove(key.(Bytes))
+	if err != nil {
+		panic(err)
+	}
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func (t *PagedBPTree) Length() int {
+	return t.t.length
+}
+
+// Validate checks the tree like BPTree.Validate, reading all pages, and that no page is left pinned.
+func (t *PagedBPTree) Validate() bool {
+	ok := false
+	if err := t.run(false, func() { ok = t.t.Validate() }); err != nil {
+		return false
+	}
+	return ok && !t.pool.pinned()
+}
@@ -0,0 +1,387 @@
+package bptree_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/bptree"
+)
+
+const testPageSize = 256
+
+func openPaged(t *testing.T, path string, opts ...PagedOption) *PagedBPTree {
+	t.Helper()
+	opts = append([]PagedOption{WithPageSize(testPageSize), WithMaxKeySize(16), WithMaxValueSize(16), WithFrames(8)}, opts...)
+	tree, err := OpenPaged(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func tempFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "paged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "tree"), func() { os.RemoveAll(dir) }
+}
+
+func keyOf(i int) []byte {
+	return []byte(fmt.Sprintf("key%05d", i))
+}
+
+func checkPaged(t *testing.T, tree *PagedBPTree, model map[string]string) {
+	t.Helper()
+	if !tree.Validate() {
+		t.Fatalf("Validate: broken tree")
+	}
+	if tree.Length() != len(model) {
+		t.Fatalf("Length: expected %v, actual %v", len(model), tree.Length())
+	}
+	for i := 0; i < 1000; i++ {
+		v, ok, err := tree.Get(keyOf(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, exists := model[string(keyOf(i))]
+		if ok != exists || string(v) != expected {
+			t.Fatalf("Get: key %s, expected %q %v, actual %q %v", keyOf(i), expected, exists, v, ok)
+		}
+	}
+	var keys, scanned []string
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	err := tree.Scan(nil, nil, func(key, value []byte) bool {
+		scanned = append(scanned, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(scanned) != fmt.Sprint(keys) {
+		t.Fatalf("Scan: expected %v keys, actual %v keys", len(keys), len(scanned))
+	}
+}
+
+// randomOps runs n random Puts and Removes of keys in [0, 1000) on tree and model.
+func randomOps(t *testing.T, tree *PagedBPTree, model map[string]string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		k := keyOf(rand.Intn(1000))
+		if rand.Intn(3) == 0 {
+			v, ok, err := tree.Remove(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, exists := model[string(k)]
+			if ok != exists || string(v) != expected {
+				t.Fatalf("Remove: key %s, expected %q %v, actual %q %v", k, expected, exists, v, ok)
+			}
+			delete(model, string(k))
+		} else {
+			v := fmt.Sprint("v", i)
+			if err := tree.Put(k, []byte(v)); err != nil {
+				t.Fatal(err)
+			}
+			model[string(k)] = v
+		}
+		if i%1000 == 0 {
+			checkPaged(t, tree, model)
+		}
+	}
+	checkPaged(t, tree, model)
+}
+
+func TestPagedBPTree(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	model := make(map[string]string)
+	randomOps(t, tree, model, 10000)
+	if s := tree.PoolStats(); s.Evictions == 0 || s.WriteBacks == 0 {
+		t.Errorf("PoolStats: expected evictions and write-backs with 8 frames, actual %+v", s)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tree.Get(keyOf(0)); err != ErrClosed {
+		t.Errorf("Get: expected ErrClosed, actual %v", err)
+	}
+
+	tree = openPaged(t, path)
+	checkPaged(t, tree, model)
+	for k := range model {
+		if _, _, err := tree.Remove([]byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkPaged(t, tree, nil)
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPagedBPTreeFewFrames(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path, WithFrames(1))
+	defer tree.Close()
+	randomOps(t, tree, make(map[string]string), 3000)
+}
+
+func TestPagedBPTreeReusesFreedPages(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	fill := func() {
+		for i := 0; i < 1000; i++ {
+			if err := tree.Put(keyOf(i), keyOf(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tree.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fill()
+	fi, _ := os.Stat(path)
+	for i := 0; i < 1000; i++ {
+		tree.Remove(keyOf(i))
+	}
+	fill()
+	if fi2, _ := os.Stat(path); fi2.Size() != fi.Size() {
+		t.Errorf("Free: expected file size %v, actual %v", fi.Size(), fi2.Size())
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPagedBPTreeRollback(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	model := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		tree.Put(keyOf(i), keyOf(i))
+		model[string(keyOf(i))] = string(keyOf(i))
+	}
+	for i := 0; i < 1000; i += 3 {
+		tree.DeleteRange(keyOf(i), keyOf(i+2))
+		delete(model, string(keyOf(i)))
+		delete(model, string(keyOf(i+1)))
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Break the free list, so that the first Put allocating a page fails after splitting nodes in memory.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var freed []int
+	for off := testPageSize; off < len(data); off += testPageSize {
+		if data[off] == 3 {
+			freed = append(freed, off)
+			data[off] = 0
+		}
+	}
+	if len(freed) == 0 {
+		t.Fatalf("expected freed pages")
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree = openPaged(t, path)
+	for i := 0; err == nil; i += 3 {
+		if err = tree.Put(keyOf(i), []byte("new")); err == nil {
+			model[string(keyOf(i))] = "new"
+		}
+	}
+	if err != ErrCorrupted {
+		t.Fatalf("Put: expected ErrCorrupted, actual %v", err)
+	}
+	checkPaged(t, tree, model)
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, off := range freed {
+		data[off] = 3
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree = openPaged(t, path)
+	defer tree.Close()
+	for i := 0; i < 1000; i++ {
+		if err := tree.Put(keyOf(i), keyOf(i)); err != nil {
+			t.Fatal(err)
+		}
+		model[string(keyOf(i))] = string(keyOf(i))
+	}
+	checkPaged(t, tree, model)
+}
+
+func TestPagedBPTreeScanRange(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	defer tree.Close()
+	for i := 0; i < 100; i++ {
+		tree.Put(keyOf(i), keyOf(i))
+	}
+	var got []string
+	tree.Scan(keyOf(18), keyOf(22), func(key, value []byte) bool {
+		got = append(got, string(key)+"="+string(value))
+		return true
+	})
+	expected := []string{"key00018=key00018", "key00019=key00019", "key00020=key00020", "key00021=key00021"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Scan: expected %v, actual %v", expected, got)
+	}
+}
+
+func TestPagedBPTreeRange(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	defer tree.Close()
+	model := make(map[string]string)
+	for _, i := range rand.Perm(1000) {
+		tree.Put(keyOf(i), keyOf(i))
+		model[string(keyOf(i))] = string(keyOf(i))
+	}
+	if num, err := tree.CountRange(keyOf(100), keyOf(200)); err != nil || num != 100 {
+		t.Errorf("CountRange: expected 100, actual %v %v", num, err)
+	}
+	if num, err := tree.DeleteRange(keyOf(100), keyOf(300)); err != nil || num != 200 {
+		t.Errorf("DeleteRange: expected 200, actual %v %v", num, err)
+	}
+	for i := 100; i < 300; i++ {
+		delete(model, string(keyOf(i)))
+	}
+	checkPaged(t, tree, model)
+	if num, err := tree.CountRange(keyOf(0), keyOf(1000)); err != nil || num != 800 {
+		t.Errorf("CountRange: expected 800, actual %v %v", num, err)
+	}
+}
+
+func TestPagedBPTreeCompact(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	model := make(map[string]string)
+	for _, i := range rand.Perm(1000) {
+		tree.Put(keyOf(i), keyOf(i))
+		model[string(keyOf(i))] = string(keyOf(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if rand.Intn(4) != 0 {
+			tree.Remove(keyOf(i))
+			delete(model, string(keyOf(i)))
+		}
+	}
+	before, err := tree.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for done := false; !done; {
+		if _, _, done, err = tree.CompactStep(1, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := tree.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Leaves >= before.Leaves {
+		t.Errorf("CompactStep: expected fewer leaves than %v, actual %v", before.Leaves, after.Leaves)
+	}
+	checkPaged(t, tree, model)
+	if _, after, err = tree.Compact(1); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := tree.Stats(); err != nil || s != after {
+		t.Errorf("Stats: expected %+v, actual %+v %v", after, s, err)
+	}
+	checkPaged(t, tree, model)
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tree = openPaged(t, path)
+	defer tree.Close()
+	checkPaged(t, tree, model)
+}
+
+func TestPagedBPTreeSplitPolicy(t *testing.T) {
+	fill := func(opts ...Option) float64 {
+		path, cleanup := tempFile(t)
+		defer cleanup()
+		tree := openPaged(t, path, WithTreeOptions(opts...))
+		defer tree.Close()
+		for i := 0; i < 1000; i++ {
+			tree.Put(keyOf(i), keyOf(i))
+		}
+		if !tree.Validate() {
+			t.Fatalf("Validate: broken tree")
+		}
+		s, err := tree.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.LeafFill
+	}
+	middle, biased := fill(), fill(WithSplitPolicy(SplitRightBiased))
+	if biased < 0.8 || biased <= middle {
+		t.Errorf("SplitRightBiased: expected leaf fill above 0.8 and %v, actual %v", middle, biased)
+	}
+}
+
+func TestPagedBPTreeErrors(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	if err := tree.Put(make([]byte, 17), nil); err != ErrTooLarge {
+		t.Errorf("Put: expected ErrTooLarge, actual %v", err)
+	}
+	tree.Close()
+	if err := ioutil.WriteFile(path, []byte("not a tree"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenPaged(path); err == nil {
+		t.Errorf("OpenPaged: expected error on corrupted file")
+	}
+}
+
+func TestPagedBPTreeADT(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	tree := openPaged(t, path)
+	defer tree.Close()
+	var a adt.ADT = tree
+	a.Insert(Bytes("a"), []byte("1"))
+	a.Insert(Bytes("b"), []byte{})
+	if v := a.Search(Bytes("b")); v == nil || len(v.([]byte)) != 0 {
+		t.Errorf("Search: expected empty value, actual %v", v)
+	}
+	if v := a.Delete(Bytes("a")); string(v.([]byte)) != "1" {
+		t.Errorf("Delete: expected 1, actual %v", v)
+	}
+	if v := a.Search(Bytes("a")); v != nil {
+		t.Errorf("Search: expected nil, actual %v", v)
+	}
+	if a.Length() != 1 {
+		t.Errorf("Length: expected 1, actual %v", a.Length())
+	}
+}
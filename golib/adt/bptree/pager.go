@@ -0,0 +1,26 @@
+package bptree
+
+import (
+	"os"
+)
+
+// pager reads and writes fixed-size pages of a file.
+// Page 0 is the meta page, so 0 is never the id of a node page.
+type pager struct {
+	f        *os.File
+	pageSize int
+	// count is the number of pages in the file, including pages only in the buffer pool yet.
+	count uint64
+	// freeHead is the first freed page, each freed page links the next one.
+	freeHead uint64
+}
+
+func (p *pager) read(id uint64, buf []byte) error {
+	_, err := p.f.ReadAt(buf[:p.pageSize], int64(id)*int64(p.pageSize))
+	return err
+}
+
+func (p *pager) write(id uint64, buf []byte) error {
+	_, err := p.f.WriteAt(buf[:p.pageSize], int64(id)*int64(p.pageSize))
+	return err
+}
@@ -0,0 +1,173 @@
+package prefix
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+type node struct {
+	leaf bool
+	// prefix is a common prefix of the keys, and suffixes are the rest of the keys.
+	// Keys of internal nodes are separators.
+	prefix   []byte
+	suffixes [][]byte
+	values   []interface{}
+	children []*node
+	// prev and next link leaves in key order.
+	prev *node
+	next *node
+}
+
+// find returns the index of the first key not less than key, and whether it equals key.
+func (n *node) find(key []byte) (int, bool) {
+	p := len(n.prefix)
+	if len(key) < p || !bytes.Equal(key[:p], n.prefix) {
+		// Key is less or greater than all keys.
+		if bytes.Compare(key, n.prefix) < 0 {
+			return 0, false
+		}
+		return len(n.suffixes), false
+	}
+	rest := key[p:]
+	i := sort.Search(len(n.suffixes), func(i int) bool { return bytes.Compare(n.suffixes[i], rest) >= 0 })
+	return i, i < len(n.suffixes) && bytes.Equal(n.suffixes[i], rest)
+}
+
+// size returns the number of keys of a leaf, or the number of children of an internal node.
+func (n *node) size() int {
+	if n.leaf {
+		return len(n.suffixes)
+	}
+	return len(n.children)
+}
+
+// key returns the ith full key.
+func (n *node) key(i int) []byte {
+	k := make([]byte, 0, len(n.prefix)+len(n.suffixes[i]))
+	return append(append(k, n.prefix...), n.suffixes[i]...)
+}
+
+func (n *node) keys() [][]byte {
+	keys := make([][]byte, len(n.suffixes))
+	for i := range keys {
+		keys[i] = n.key(i)
+	}
+	return keys
+}
+
+// setKeys replaces the keys, with their longest common prefix as the prefix.
+func (n *node) setKeys(keys [][]byte) {
+	n.prefix = nil
+	if len(keys) > 0 {
+		p := keys[0]
+		for _, k := range keys[1:] {
+			p = p[:commonPrefix(p, k)]
+		}
+		n.prefix = clone(p)
+	}
+	n.suffixes = make([][]byte, len(keys))
+	for i, k := range keys {
+		n.suffixes[i] = clone(k[len(n.prefix):])
+	}
+}
+
+// insertKey inserts key at i, and shortens the prefix if key does not have it.
+func (n *node) insertKey(i int, key []byte) {
+	if q := commonPrefix(n.prefix, key); q < len(n.prefix) {
+		for j, s := range n.suffixes {
+			n.suffixes[j] = append(clone(n.prefix[q:]), s...)
+		}
+		n.prefix = clone(n.prefix[:q])
+	}
+	n.suffixes = append(n.suffixes, nil)
+	copy(n.suffixes[i+1:], n.suffixes[i:])
+	n.suffixes[i] = clone(key[len(n.prefix):])
+}
+
+// deleteKey deletes the ith key, and keeps the prefix, which may be no longer the longest.
+func (n *node) deleteKey(i int) {
+	n.suffixes = append(n.suffixes[:i], n.suffixes[i+1:]...)
+}
+
+func (n *node) replaceKey(i int, key []byte) {
+	n.deleteKey(i)
+	n.insertKey(i, key)
+}
+
+func (n *node) rightmostLeaf() *node {
+	for !n.leaf {
+		n = n.children[len(n.children)-1]
+	}
+	return n
+}
+
+func (n *node) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	var sb strings.Builder
+	kind := "i"
+	if n.leaf {
+		kind = "l"
+	}
+	sb.WriteString(fmt.Sprintf("[<%v:%v>:%q|", kind, len(n.suffixes), n.prefix))
+	for i, s := range n.suffixes {
+		if i != 0 {
+			sb.WriteString(":")
+		}
+		sb.WriteString(fmt.Sprintf("%q", s))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+func (n *node) Iterator() adt.Iterator {
+	if n == nil || n.leaf {
+		return nil
+	}
+	return &iterator{nodes: n.children}
+}
+
+type iterator struct {
+	nodes []*node
+	idx   int
+}
+
+func (i *iterator) HasNext() bool {
+	return i.idx < len(i.nodes)
+}
+
+func (i *iterator) Next() adt.MultiWayTreeNode {
+	n := i.nodes[i.idx]
+	i.idx++
+	return n
+}
+
+// separator returns the shortest key s with left <= s < right, for left < right.
+func separator(left, right []byte) []byte {
+	for q := commonPrefix(left, right); q < len(left)-1; q++ {
+		if c := left[q]; c < 0xff {
+			s := append(clone(left[:q]), c+1)
+			if bytes.Compare(s, right) < 0 {
+				return s
+			}
+		}
+	}
+	return clone(left)
+}
+
+func commonPrefix(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,355 @@
+// Package prefix is an in-memory B+ tree of byte-string keys with prefix compression.
+//
+// Each node stores a common prefix of its keys once, and only the suffixes of the keys in its slots.
+// Internal nodes hold the shortest separators between their children, known as suffix truncation,
+// instead of copies of leaf keys, which makes their suffixes even shorter.
+// It suits keys sharing long prefixes, like paths or URLs.
+//
+// It is a standalone tree rather than a key storage mode of package bptree, so it has no cursor, CountRange,
+// DeleteRange, split policies or Compact.
+package prefix
+
+import (
+	"bytes"
+
+	"github.com/atriw/lib/golib/adt"
+	"github.com/atriw/lib/golib/adt/bptree"
+)
+
+// Bytes is a byte-string key of BPTree, the same type as bptree.Bytes
+type Bytes = bptree.Bytes
+
+// BPTree is a B+ tree of Bytes keys with prefix compression, not safe for concurrent use.
+type BPTree struct {
+	root   *node
+	order  int
+	length int
+}
+
+const defaultOrder = 64
+
+func New(opts ...Option) *BPTree {
+	t := &BPTree{order: defaultOrder}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.order <= 3 {
+		panic("order should be at least 4")
+	}
+	return t
+}
+
+// Option is BPTree initialization options
+type Option func(*BPTree)
+
+// WithOrder sets the max number of keys of leaves and children of internal nodes
+func WithOrder(order int) Option {
+	return func(t *BPTree) {
+		t.order = order
+	}
+}
+
+func (t *BPTree) underflow(n *node) bool {
+	return n.size() < (t.order+1)/2
+}
+
+// Search returns the value of key, which must be Bytes.
+func (t *BPTree) Search(key adt.Key) interface{} {
+	if t.root == nil {
+		return nil
+	}
+	k := key.(Bytes)
+	n := t.root
+	for !n.leaf {
+		i, _ := n.find(k)
+		n = n.children[i]
+	}
+	i, exact := n.find(k)
+	if !exact {
+		return nil
+	}
+	return n.values[i]
+}
+
+// Insert sets the value of key, which must be Bytes.
+func (t *BPTree) Insert(key adt.Key, value interface{}) {
+	k := key.(Bytes)
+	if t.root == nil {
+		t.root = &node{leaf: true, values: []interface{}{value}}
+		t.root.setKeys([][]byte{k})
+		t.length++
+		return
+	}
+	sep, split, added := t.insert(t.root, k, value)
+	if added {
+		t.length++
+	}
+	if split == nil {
+		return
+	}
+	root := &node{children: []*node{t.root, split}}
+	root.setKeys([][]byte{sep})
+	t.root = root
+}
+
+// insert inserts into the subtree n, and returns the separator and the split node if n splits,
+// and whether key is added rather than updated.
+func (t *BPTree) insert(n *node, key []byte, value interface{}) (sep []byte, split *node, added bool) {
+	i, exact := n.find(key)
+	if n.leaf {
+		if exact {
+			n.values[i] = value
+			return nil, nil, false
+		}
+		n.insertKey(i, key)
+		n.values = append(n.values, nil)
+		copy(n.values[i+1:], n.values[i:])
+		n.values[i] = value
+		added = true
+	} else {
+		sep, split, added = t.insert(n.children[i], key, value)
+		if split == nil {
+			return nil, nil, added
+		}
+		n.insertKey(i, sep)
+		n.children = append(n.children, nil)
+		copy(n.children[i+2:], n.children[i+1:])
+		n.children[i+1] = split
+	}
+	if n.size() <= t.order {
+		return nil, nil, added
+	}
+	sep, split = t.split(n)
+	return sep, split, added
+}
+
+// split moves the upper half of the overflow node n to a new node, and returns the separator and the new node.
+// The separator of leaves is the shortest key between the two halves.
+func (t *BPTree) split(n *node) ([]byte, *node) {
+	keys := n.keys()
+	half := n.size() / 2
+	s := &node{leaf: n.leaf}
+	var sep []byte
+	if n.leaf {
+		sep = separator(keys[half-1], keys[half])
+		s.setKeys(keys[half:])
+		n.setKeys(keys[:half])
+		s.values = append([]interface{}(nil), n.values[half:]...)
+		n.values = append([]interface{}(nil), n.values[:half]...)
+		s.prev, s.next = n, n.next
+		if n.next != nil {
+			n.next.prev = s
+		}
+		n.next = s
+	} else {
+		sep = keys[half-1]
+		s.setKeys(keys[half:])
+		n.setKeys(keys[:half-1])
+		s.children = append([]*node(nil), n.children[half:]...)
+		n.children = append([]*node(nil), n.children[:half]...)
+	}
+	return sep, s
+}
+
+// Delete deletes key, which must be Bytes, and returns its value.
+func (t *BPTree) Delete(key adt.Key) interface{} {
+	if t.root == nil {
+		return nil
+	}
+	value, found, _ := t.delete(t.root, key.(Bytes))
+	if !found {
+		return nil
+	}
+	t.length--
+	if t.root.size() == 0 {
+		t.root = nil
+	} else if !t.root.leaf && t.root.size() == 1 {
+		t.root = t.root.children[0]
+	}
+	return value
+}
+
+// delete deletes key from the subtree n, and reports whether n underflows.
+// An underflow child is merged with a sibling if they fit in one node, otherwise they are redistributed evenly.
+func (t *BPTree) delete(n *node, key []byte) (value interface{}, found bool, underflow bool) {
+	i, exact := n.find(key)
+	if n.leaf {
+		if !exact {
+			return nil, false, false
+		}
+		value = n.values[i]
+		n.deleteKey(i)
+		n.values = append(n.values[:i], n.values[i+1:]...)
+		return value, true, t.underflow(n)
+	}
+	value, found, underflow = t.delete(n.children[i], key)
+	if !underflow {
+		return value, found, false
+	}
+	if i == len(n.children)-1 {
+		i--
+	}
+	t.rebalance(n, i)
+	return value, found, t.underflow(n)
+}
+
+// rebalance merges the ith and (i+1)th children of n if they fit in one node, otherwise redistributes evenly.
+func (t *BPTree) rebalance(n *node, i int) {
+	left, right := n.children[i], n.children[i+1]
+	if left.size()+right.size() <= t.order {
+		if left.leaf {
+			left.setKeys(append(left.keys(), right.keys()...))
+			left.values = append(left.values, right.values...)
+			left.next = right.next
+			if right.next != nil {
+				right.next.prev = left
+			}
+		} else {
+			left.setKeys(append(append(left.keys(), n.key(i)), right.keys()...))
+			left.children = append(left.children, right.children...)
+		}
+		n.deleteKey(i)
+		n.children = append(n.children[:i+1], n.children[i+2:]...)
+		return
+	}
+	if left.leaf {
+		keys, values := append(left.keys(), right.keys()...), append(left.values, right.values...)
+		half := len(keys) / 2
+		left.setKeys(keys[:half])
+		right.setKeys(keys[half:])
+		left.values, right.values = append([]interface{}(nil), values[:half]...), append([]interface{}(nil), values[half:]...)
+		n.replaceKey(i, separator(keys[half-1], keys[half]))
+		return
+	}
+	keys := append(append(left.keys(), n.key(i)), right.keys()...)
+	children := append(append([]*node(nil), left.children...), right.children...)
+	half := len(children) / 2
+	left.setKeys(keys[:half-1])
+	right.setKeys(keys[half:])
+	left.children, right.children = children[:half:half], children[half:]
+	n.replaceKey(i, keys[half-1])
+}
+
+// Scan calls fn on each key in [start, end) in order along the leaf chain until fn returns false,
+// a nil end means no upper bound.
+func (t *BPTree) Scan(start, end []byte, fn func(key []byte, value interface{}) bool) {
+	if t.root == nil {
+		return
+	}
+	n := t.root
+	for !n.leaf {
+		i, _ := n.find(start)
+		n = n.children[i]
+	}
+	i, _ := n.find(start)
+	for ; n != nil; n, i = n.next, 0 {
+		for ; i < len(n.suffixes); i++ {
+			k := n.key(i)
+			if end != nil && bytes.Compare(k, end) >= 0 || !fn(k, n.values[i]) {
+				return
+			}
+		}
+	}
+}
+
+func (t *BPTree) Length() int {
+	return t.length
+}
+
+func (t *BPTree) String() string {
+	return adt.PrintMultiWayTree(t.root)
+}
+
+// Stats describes the key storage of a BPTree.
+type Stats struct {
+	Nodes int
+	// KeyBytes is the number of bytes of the prefixes and suffixes in nodes.
+	KeyBytes int
+	// FullKeyBytes is what KeyBytes would be if nodes stored full keys, and internal nodes stored
+	// the last keys of their children as separators.
+	FullKeyBytes int
+}
+
+func (t *BPTree) Stats() Stats {
+	var s Stats
+	if t.root != nil {
+		t.stats(t.root, &s)
+	}
+	return s
+}
+
+func (t *BPTree) stats(n *node, s *Stats) {
+	s.Nodes++
+	s.KeyBytes += len(n.prefix)
+	for i, suffix := range n.suffixes {
+		s.KeyBytes += len(suffix)
+		if n.leaf {
+			s.FullKeyBytes += len(n.prefix) + len(suffix)
+			continue
+		}
+		last := n.children[i].rightmostLeaf()
+		s.FullKeyBytes += len(last.prefix) + len(last.suffixes[len(last.suffixes)-1])
+	}
+	for _, c := range n.children {
+		t.stats(c, s)
+	}
+}
+
+// Validate checks order, fill, height, leaf links and length of the tree.
+func (t *BPTree) Validate() bool {
+	if t.root == nil {
+		return t.length == 0
+	}
+	v := &validator{t: t}
+	if _, ok := v.check(t.root, nil, nil, true); !ok {
+		return false
+	}
+	return v.num == t.length && v.last.next == nil
+}
+
+type validator struct {
+	t    *BPTree
+	num  int
+	last *node
+}
+
+// check checks the subtree n whose keys are in (lo, hi], a nil bound means unbounded, and returns its height.
+func (v *validator) check(n *node, lo, hi []byte, root bool) (int, bool) {
+	if n.size() > v.t.order || !root && v.t.underflow(n) || root && !n.leaf && n.size() < 2 {
+		return 0, false
+	}
+	if !n.leaf && len(n.children) != len(n.suffixes)+1 || n.leaf && len(n.values) != len(n.suffixes) {
+		return 0, false
+	}
+	keys := n.keys()
+	for i, k := range keys {
+		if lo != nil && bytes.Compare(k, lo) <= 0 || hi != nil && bytes.Compare(k, hi) > 0 ||
+			i > 0 && bytes.Compare(keys[i-1], k) >= 0 {
+			return 0, false
+		}
+	}
+	if n.leaf {
+		if n.prev != v.last || v.last != nil && v.last.next != n {
+			return 0, false
+		}
+		v.last = n
+		v.num += len(keys)
+		return 0, true
+	}
+	h := -1
+	for i, c := range n.children {
+		clo, chi := lo, hi
+		if i > 0 {
+			clo = keys[i-1]
+		}
+		if i < len(keys) {
+			chi = keys[i]
+		}
+		ch, ok := v.check(c, clo, chi, false)
+		if !ok || h >= 0 && ch != h {
+			return 0, false
+		}
+		h = ch
+	}
+	return h + 1, true
+}
@@ -0,0 +1,175 @@
+package prefix_test
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	"github.com/atriw/lib/golib/adt/bptree"
+	. "github.com/atriw/lib/golib/adt/bptree/prefix"
+)
+
+// randomKey returns keys of varied lengths sharing prefixes, some shorter than the prefixes of nodes.
+func randomKey(r *rand.Rand) string {
+	switch r.Intn(4) {
+	case 0:
+		return fmt.Sprintf("%x", r.Intn(64))
+	case 1:
+		return fmt.Sprintf("a/b/%x", r.Intn(256))
+	default:
+		return fmt.Sprintf("a/b/c/%x/%x", r.Intn(16), r.Intn(64))
+	}
+}
+
+func check(t *testing.T, tree *BPTree, model map[string]int) {
+	t.Helper()
+	if !tree.Validate() {
+		t.Fatalf("Validate: broken tree\n%v", tree)
+	}
+	if tree.Length() != len(model) {
+		t.Fatalf("Length: expected %v, actual %v", len(model), tree.Length())
+	}
+	var keys, scanned []string
+	for k, v := range model {
+		keys = append(keys, k)
+		if actual := tree.Search(Bytes(k)); actual != v {
+			t.Fatalf("Search: key %q, expected %v, actual %v", k, v, actual)
+		}
+	}
+	sort.Strings(keys)
+	tree.Scan(nil, nil, func(key []byte, value interface{}) bool {
+		scanned = append(scanned, string(key))
+		return true
+	})
+	if fmt.Sprint(scanned) != fmt.Sprint(keys) {
+		t.Fatalf("Scan: expected %v, actual %v", keys, scanned)
+	}
+}
+
+func TestBPTree(t *testing.T) {
+	for _, order := range []int{4, 5, 16} {
+		r := rand.New(rand.NewSource(int64(order)))
+		tree := New(WithOrder(order))
+		model := make(map[string]int)
+		for i := 0; i < 5000; i++ {
+			k := randomKey(r)
+			if r.Intn(3) == 0 {
+				v := tree.Delete(Bytes(k))
+				if expected, ok := model[k]; ok != (v != nil) || ok && v != expected {
+					t.Fatalf("Delete: key %q, expected %v, actual %v", k, expected, v)
+				}
+				delete(model, k)
+			} else {
+				tree.Insert(Bytes(k), i)
+				model[k] = i
+			}
+			if i%100 == 0 {
+				check(t, tree, model)
+			}
+		}
+		check(t, tree, model)
+		for k := range model {
+			tree.Delete(Bytes(k))
+		}
+		check(t, tree, nil)
+	}
+}
+
+func TestBPTreeScanRange(t *testing.T) {
+	tree := New(WithOrder(4))
+	for i := 0; i < 100; i++ {
+		tree.Insert(Bytes(fmt.Sprintf("key%03d", i)), i)
+	}
+	var got []string
+	tree.Scan([]byte("key018"), []byte("key022"), func(key []byte, value interface{}) bool {
+		got = append(got, fmt.Sprint(string(key), "=", value))
+		return true
+	})
+	expected := []string{"key018=18", "key019=19", "key020=20", "key021=21"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Scan: expected %v, actual %v", expected, got)
+	}
+}
+
+var categories = []string{"books", "electronics", "garden", "toys"}
+
+// urls returns num shuffled URL paths sharing long prefixes.
+func urls(num int) [][]byte {
+	r := rand.New(rand.NewSource(1))
+	keys := make([][]byte, num)
+	for i := range keys {
+		c := categories[r.Intn(len(categories))]
+		keys[i] = []byte(fmt.Sprintf("https://shop.example.com/catalog/%v/section-%02d/product-%07d.html", c, r.Intn(20), i))
+	}
+	r.Shuffle(num, func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	return keys
+}
+
+func TestBPTreeStats(t *testing.T) {
+	tree := New()
+	for i, k := range urls(100000) {
+		tree.Insert(Bytes(k), i)
+	}
+	if !tree.Validate() {
+		t.Fatalf("Validate: broken tree")
+	}
+	s := tree.Stats()
+	saved := 1 - float64(s.KeyBytes)/float64(s.FullKeyBytes)
+	t.Logf("nodes %v, key bytes %v, full key bytes %v, saved %.0f%%", s.Nodes, s.KeyBytes, s.FullKeyBytes, saved*100)
+	if saved < 0.5 {
+		t.Errorf("Stats: expected to save at least half of key bytes, actual %.2f", saved)
+	}
+}
+
+// BenchmarkBPTreeMemory reports the heap bytes per URL key, against bptree.BPTree storing full keys.
+func BenchmarkBPTreeMemory(b *testing.B) {
+	keys := urls(100000)
+	for _, c := range []struct {
+		name string
+		new  func() adt.ADT
+	}{
+		{"bptree", func() adt.ADT { return bptree.New(bptree.WithOrder(64)) }},
+		{"prefix", func() adt.ADT { return New(WithOrder(64)) }},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				tree := c.new()
+				for j, k := range keys {
+					tree.Insert(Bytes(append([]byte(nil), k...)), j)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(tree)
+			}
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(len(keys)), "heap-B/key")
+		})
+	}
+}
+
+func BenchmarkBPTreeSearch(b *testing.B) {
+	keys := urls(100000)
+	for _, c := range []struct {
+		name string
+		new  func() adt.ADT
+	}{
+		{"bptree", func() adt.ADT { return bptree.New(bptree.WithOrder(64)) }},
+		{"prefix", func() adt.ADT { return New(WithOrder(64)) }},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			tree := c.new()
+			for j, k := range keys {
+				tree.Insert(Bytes(k), j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tree.Search(Bytes(keys[i%len(keys)]))
+			}
+		})
+	}
+}
@@ -80,6 +80,72 @@ func XTestADT(t *testing.T, adt ADT) {
 	validate(t, adt)
 }
 
+func XTestDeleteRange(t *testing.T, f func() RangeDeleter) {
+	adt := f()
+	for _, n := range randNums(100) {
+		adt.Insert(n, n*2)
+	}
+	num, entries := adt.DeleteRange(key(20), key(60), true)
+	if num != 40 || len(entries) != 40 {
+		t.Errorf("DeleteRange: expected 40, actual %v, %v entries", num, len(entries))
+	}
+	for i, e := range entries {
+		if !e.Key.Equal(key(20+i)) || !key(40+2*i).Equal(e.Value) {
+			t.Errorf("DeleteRange: expected entry %v:%v, actual %v:%v", 20+i, 40+2*i, e.Key, e.Value)
+		}
+	}
+	if adt.Length() != 60 {
+		t.Errorf("DeleteRange: expected len 60, actual len %v", adt.Length())
+	}
+	validate(t, adt)
+	for i := 0; i < 100; i++ {
+		v := adt.Search(key(i))
+		if (i >= 20 && i < 60) != (v == nil) {
+			t.Errorf("Search: key %v, actual %v", i, v)
+		}
+	}
+	if num, _ := adt.DeleteRange(key(30), key(10), false); num != 0 {
+		t.Errorf("DeleteRange: empty range, expected 0, actual %v", num)
+	}
+	if num, entries := adt.DeleteRange(key(-1), key(100), false); num != 60 || entries != nil {
+		t.Errorf("DeleteRange: expected 60 and no entries, actual %v, %v", num, entries)
+	}
+	if adt.Length() != 0 {
+		t.Errorf("DeleteRange: expected len 0, actual len %v", adt.Length())
+	}
+
+	adt = f()
+	present := make(map[key]bool)
+	for _, n := range randNums(2000) {
+		adt.Insert(n, n)
+		present[n] = true
+	}
+	for i := 0; i < 50; i++ {
+		lo := key(rand.Intn(2000))
+		hi := lo + key(rand.Intn(200))
+		expected := 0
+		for k := lo; k < hi; k++ {
+			if present[k] {
+				expected++
+				delete(present, k)
+			}
+		}
+		if num, _ := adt.DeleteRange(lo, hi, false); num != expected {
+			t.Fatalf("DeleteRange: [%v, %v), expected %v, actual %v", lo, hi, expected, num)
+		}
+		if adt.Length() != len(present) {
+			t.Fatalf("DeleteRange: expected len %v, actual len %v", len(present), adt.Length())
+		}
+		validate(t, adt)
+		for j := 0; j < 50; j++ {
+			k := key(rand.Intn(2000))
+			if v := adt.Search(k); present[k] != (v != nil) {
+				t.Fatalf("Search: key %v, expected present %v, actual %v", k, present[k], v)
+			}
+		}
+	}
+}
+
 func randNums(n int) []key {
 	var nums []key
 	for i := 0; i < n; i++ {
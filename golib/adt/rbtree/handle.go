@@ -0,0 +1,155 @@
+package rbtree
+
+import (
+	"github.com/atriw/lib/golib/adt"
+)
+
+// Handle refers to an entry of RBTree, to access, update or delete it without searching.
+// Nodes keep their entries through rotations and deletions of other entries,
+// so a handle stays valid until its entry is deleted.
+type Handle struct {
+	t *RBTree
+	n *node
+}
+
+// Valid reports whether the entry of h is still in the tree.
+func (h *Handle) Valid() bool {
+	return !h.n.isExternal()
+}
+
+// Key returns the key of the entry, it panics if h is not valid.
+func (h *Handle) Key() adt.Key {
+	h.mustValid()
+	return h.n.Key
+}
+
+// Value returns the value of the entry, it panics if h is not valid.
+func (h *Handle) Value() interface{} {
+	h.mustValid()
+	return h.n.Value
+}
+
+// SetValue sets the value of the entry, it panics if h is not valid.
+func (h *Handle) SetValue(value interface{}) {
+	h.mustValid()
+	h.n.Value = value
+	h.t.updatePath(h.n)
+}
+
+// Next returns the handle of the next entry in key order, or nil.
+func (h *Handle) Next() *Handle {
+	h.mustValid()
+	return h.t.handle(h.n.next())
+}
+
+// Prev returns the handle of the previous entry in key order, or nil.
+func (h *Handle) Prev() *Handle {
+	h.mustValid()
+	return h.t.handle(h.n.prev())
+}
+
+func (h *Handle) mustValid() {
+	if !h.Valid() {
+		panic("invalid handle")
+	}
+}
+
+func (t *RBTree) handle(n *node) *Handle {
+	if n == nil || n.isExternal() {
+		return nil
+	}
+	return &Handle{t: t, n: n}
+}
+
+// InsertHandle is Insert, and returns the handle of the entry.
+func (t *RBTree) InsertHandle(key adt.Key, value interface{}) *Handle {
+	p, dir := t.search(key)
+	return t.handle(t.insert(p, dir, key, value))
+}
+
+// InsertHint is InsertHandle, but first tries to place key right after the entry of hint, like C++ emplace_hint.
+// If key is not between hint and the next entry, it falls back to a full search.
+// Inserting sorted keys with the previously returned handle takes amortized O(1).
+func (t *RBTree) InsertHint(hint *Handle, key adt.Key, value interface{}) *Handle {
+	if hint == nil || hint.t != t || !hint.Valid() || key.Less(hint.n.Key) {
+		return t.InsertHandle(key, value)
+	}
+	p := hint.n
+	if key.Equal(p.Key) {
+		return t.handle(t.insert(p, self, key, value))
+	}
+	var next *node
+	if p != t.max {
+		next = p.next()
+	}
+	if next != nil && !key.Less(next.Key) {
+		if key.Equal(next.Key) {
+			return t.handle(t.insert(next, self, key, value))
+		}
+		return t.InsertHandle(key, value)
+	}
+	// The next entry is the leftmost of the right subtree of p if it is not external.
+	if p.right.isExternal() {
+		return t.handle(t.insert(p, right, key, value))
+	}
+	return t.handle(t.insert(next, left, key, value))
+}
+
+// SearchHandle returns the handle of key, or nil.
+func (t *RBTree) SearchHandle(key adt.Key) *Handle {
+	p, dir := t.search(key)
+	if p.isExternal() || dir != self {
+		return nil
+	}
+	return t.handle(p)
+}
+
+// First returns the handle of the min key, or nil.
+func (t *RBTree) First() *Handle {
+	n := t.root
+	for !n.isExternal() && !n.left.isExternal() {
+		n = n.left
+	}
+	return t.handle(n)
+}
+
+// DeleteHandle deletes the entry of h without searching its key, and returns its value.
+// It returns nil if h is no longer valid, and panics if h is of another tree.
+func (t *RBTree) DeleteHandle(h *Handle) interface{} {
+	if h.t != t {
+		panic("handle of another tree")
+	}
+	if !h.Valid() {
+		return nil
+	}
+	t.length--
+	v := h.n.Value
+	t.delete(h.n)
+	return v
+}
+
+// next can only be called on internal node, it returns nil for the max node.
+func (n *node) next() *node {
+	if !n.right.isExternal() {
+		return n.successor()
+	}
+	for n.isRight() {
+		n = n.parent
+	}
+	return n.parent
+}
+
+// prev can only be called on internal node, it returns nil for the min node.
+func (n *node) prev() *node {
+	if !n.left.isExternal() {
+		n = n.left
+		for !n.right.isExternal() {
+			n = n.right
+		}
+		return n
+	}
+	for n.isLeft() {
+		n = n.parent
+	}
+	return n.parent
+}
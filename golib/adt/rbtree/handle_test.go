@@ -0,0 +1,116 @@
+package rbtree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/atriw/lib/golib/adt/rbtree"
+)
+
+func TestRBTreeHandle(t *testing.T) {
+	rbt := New()
+	handles := make(map[int]*Handle)
+	for _, k := range rand.Perm(1000) {
+		handles[k] = rbt.InsertHandle(key(k), k)
+	}
+	// Handles stay valid when other entries are deleted and rotated.
+	for k := 0; k < 1000; k += 3 {
+		if v := rbt.DeleteHandle(handles[k]); v != k {
+			t.Fatalf("DeleteHandle: expected %v, actual %v", k, v)
+		}
+	}
+	rbt.DeleteRange(key(500), key(600), false)
+	if !rbt.Validate() {
+		t.Fatalf("Validate: invalid tree")
+	}
+	for k, h := range handles {
+		removed := k%3 == 0 || (k >= 500 && k < 600)
+		if h.Valid() == removed {
+			t.Fatalf("Valid %v: expected %v", k, !removed)
+		}
+		if removed {
+			if v := rbt.DeleteHandle(h); v != nil {
+				t.Fatalf("DeleteHandle: expected nil on invalid handle, actual %v", v)
+			}
+			continue
+		}
+		if h.Key() != key(k) || h.Value() != k {
+			t.Fatalf("Handle: expected %v, actual %v %v", k, h.Key(), h.Value())
+		}
+	}
+	handles[1].SetValue("one")
+	if v := rbt.Search(key(1)); v != "one" {
+		t.Errorf("SetValue: expected one, actual %v", v)
+	}
+	var prev *Handle
+	n := 0
+	for h := rbt.First(); h != nil; prev, h = h, h.Next() {
+		if prev != nil && (!prev.Key().Less(h.Key()) || h.Prev().Key() != prev.Key()) {
+			t.Fatalf("Next: unordered %v %v", prev.Key(), h.Key())
+		}
+		n++
+	}
+	if n != rbt.Length() {
+		t.Errorf("Next: expected %v entries, actual %v", rbt.Length(), n)
+	}
+	if h := rbt.First(); h.Prev() != nil {
+		t.Errorf("Prev: expected nil before the first entry")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Value: expected panic on invalid handle")
+		}
+	}()
+	handles[0].Value()
+}
+
+func TestRBTreeInsertHint(t *testing.T) {
+	rbt := New()
+	for k := 0; k < 1000; k += 2 {
+		rbt.Insert(key(k), k)
+	}
+	// Merge sorted odd keys, and some keys that do not fit the hint.
+	var h *Handle
+	for k := 1; k < 1100; k += 2 {
+		h = rbt.InsertHint(h, key(k), k)
+		if h.Key() != key(k) {
+			t.Fatalf("InsertHint: expected handle of %v, actual %v", k, h.Key())
+		}
+		if k%100 == 1 {
+			h = rbt.InsertHint(h, key(k/2), -k)
+		}
+	}
+	if !rbt.Validate() {
+		t.Fatalf("Validate: invalid tree")
+	}
+	if rbt.Length() != 1050 {
+		t.Errorf("Length: expected 1050, actual %v", rbt.Length())
+	}
+	for k := 0; k < 1100; k++ {
+		expected := interface{}(k)
+		if k >= 1000 && k%2 == 0 {
+			expected = nil
+		} else if k%50 == 0 && k < 550 {
+			expected = -(k*2 + 1)
+		}
+		if v := rbt.Search(key(k)); v != expected {
+			t.Fatalf("Search %v: expected %v, actual %v", k, expected, v)
+		}
+	}
+}
+
+func BenchmarkRBTreeSequentialInsert(b *testing.B) {
+	b.Run("search", func(b *testing.B) {
+		rbt := New()
+		for i := 0; i < b.N; i++ {
+			rbt.Insert(key(i), nil)
+		}
+	})
+	b.Run("hint", func(b *testing.B) {
+		rbt := New()
+		var h *Handle
+		for i := 0; i < b.N; i++ {
+			h = rbt.InsertHint(h, key(i), nil)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package rbtree
+
+import (
+	"github.com/atriw/lib/golib/adt"
+)
+
+// Interval is a half-open interval [Start, End) with a value.
+type Interval struct {
+	Start adt.Key
+	End   adt.Key
+	Value interface{}
+}
+
+// intervalKey orders intervals by start, then by end, so that intervals may share a start point.
+type intervalKey struct {
+	start adt.Key
+	end   adt.Key
+}
+
+func (k intervalKey) Less(other interface{}) bool {
+	o, ok := other.(intervalKey)
+	if !ok {
+		return false
+	}
+	if k.start.Less(o.start) {
+		return true
+	}
+	return k.start.Equal(o.start) && k.end.Less(o.end)
+}
+
+func (k intervalKey) Equal(other interface{}) bool {
+	o, ok := other.(intervalKey)
+	return ok && k.start.Equal(o.start) && k.end.Equal(o.end)
+}
+
+// IntervalTree is a red-black tree of intervals, each node augmented with the max end point of its subtree.
+type IntervalTree struct {
+	tree *RBTree
+}
+
+func NewInterval() *IntervalTree {
+	t := New()
+	t.augment = maxEnd
+	return &IntervalTree{tree: t}
+}
+
+// maxEnd sets the augmentation of n to the max end point of its subtree.
+func maxEnd(n *node) {
+	max := n.Key.(intervalKey).end
+	for _, c := range []*node{n.left, n.right} {
+		if !c.isExternal() && max.Less(c.aug) {
+			max = c.aug.(adt.Key)
+		}
+	}
+	n.aug = max
+}
+
+func newIntervalKey(start, end adt.Key) intervalKey {
+	if !start.Less(end) {
+		panic("invalid interval")
+	}
+	return intervalKey{start: start, end: end}
+}
+
+func (t *IntervalTree) Length() int {
+	return t.tree.Length()
+}
+
+// Insert inserts the interval [start, end), replacing the value of an identical interval.
+func (t *IntervalTree) Insert(start, end adt.Key, value interface{}) {
+	t.tree.Insert(newIntervalKey(start, end), value)
+}
+
+// Search returns the value of the interval [start, end), or nil.
+func (t *IntervalTree) Search(start, end adt.Key) interface{} {
+	return t.tree.Search(newIntervalKey(start, end))
+}
+
+// Delete deletes the interval [start, end) and returns its value, or nil.
+func (t *IntervalTree) Delete(start, end adt.Key) interface{} {
+	return t.tree.Delete(newIntervalKey(start, end))
+}
+
+// Stab returns the intervals containing x, ordered by start point.
+func (t *IntervalTree) Stab(x adt.Key) []Interval {
+	var res []Interval
+	t.tree.root.intervals(x, func(start adt.Key) bool { return !x.Less(start) }, &res)
+	return res
+}
+
+// Overlap returns the intervals overlapping [lo, hi), ordered by start point.
+func (t *IntervalTree) Overlap(lo, hi adt.Key) []Interval {
+	if !lo.Less(hi) {
+		return nil
+	}
+	var res []Interval
+	t.tree.root.intervals(lo, func(start adt.Key) bool { return start.Less(hi) }, &res)
+	return res
+}
+
+// intervals collects intervals of the subtree ending after lo and starting within bound.
+// Subtrees whose max end point is not after lo are pruned.
+func (n *node) intervals(lo adt.Key, within func(start adt.Key) bool, res *[]Interval) {
+	if n.isExternal() || !lo.Less(n.aug) {
+		return
+	}
+	n.left.intervals(lo, within, res)
+	k := n.Key.(intervalKey)
+	if !within(k.start) {
+		return
+	}
+	if lo.Less(k.end) {
+		*res = append(*res, Interval{Start: k.start, End: k.end, Value: n.Value})
+	}
+	n.right.intervals(lo, within, res)
+}
+
+func (t *IntervalTree) String() string {
+	return t.tree.String()
+}
+
+// Validate checks red-black properties and the max end point of each subtree.
+func (t *IntervalTree) Validate() bool {
+	_, ok := t.tree.root.validateMaxEnd()
+	return t.tree.Validate() && ok
+}
+
+func (n *node) validateMaxEnd() (adt.Key, bool) {
+	if n.isExternal() {
+		return nil, true
+	}
+	max := n.Key.(intervalKey).end
+	for _, c := range []*node{n.left, n.right} {
+		m, ok := c.validateMaxEnd()
+		if !ok {
+			return nil, false
+		}
+		if m != nil && max.Less(m) {
+			max = m
+		}
+	}
+	return max, max.Equal(n.aug)
+}
@@ -0,0 +1,118 @@
+package rbtree_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	. "github.com/atriw/lib/golib/adt/rbtree"
+)
+
+type key int
+
+func (k key) Less(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k < i
+}
+
+func (k key) Equal(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k == i
+}
+
+type interval struct {
+	start, end key
+}
+
+func TestIntervalTree(t *testing.T) {
+	it := NewInterval()
+	model := make(map[interval]int)
+	check := func() {
+		t.Helper()
+		if !it.Validate() {
+			t.Fatalf("Validate: invalid tree\n%v", it)
+		}
+		if it.Length() != len(model) {
+			t.Fatalf("Length: expected %v, actual %v", len(model), it.Length())
+		}
+		for q := 0; q < 20; q++ {
+			lo := key(rand.Intn(110))
+			hi := lo + key(rand.Intn(20)+1)
+			expected := 0
+			for iv := range model {
+				if iv.start < hi && lo < iv.end {
+					expected++
+				}
+			}
+			res := it.Overlap(lo, hi)
+			if len(res) != expected {
+				t.Fatalf("Overlap [%v, %v): expected %v intervals, actual %v", lo, hi, expected, res)
+			}
+			for i, r := range res {
+				if model[interval{r.Start.(key), r.End.(key)}] != r.Value.(int) {
+					t.Fatalf("Overlap: unexpected %v", r)
+				}
+				if i > 0 && r.Start.Less(res[i-1].Start) {
+					t.Fatalf("Overlap: unordered %v", res)
+				}
+			}
+			expected = 0
+			for iv := range model {
+				if iv.start <= lo && lo < iv.end {
+					expected++
+				}
+			}
+			if res := it.Stab(lo); len(res) != expected {
+				t.Fatalf("Stab %v: expected %v intervals, actual %v", lo, expected, res)
+			}
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		// Few distinct start points to have duplicates.
+		s := key(rand.Intn(25) * 4)
+		iv := interval{s, s + key(rand.Intn(30)+1)}
+		if rand.Intn(3) == 0 {
+			v := it.Delete(iv.start, iv.end)
+			if expected, ok := model[iv]; (ok && v != expected) || (!ok && v != nil) {
+				t.Fatalf("Delete %v: expected %v, actual %v", iv, expected, v)
+			}
+			delete(model, iv)
+		} else {
+			it.Insert(iv.start, iv.end, i)
+			model[iv] = i
+		}
+		if i%50 == 0 {
+			check()
+		}
+	}
+	check()
+	for iv, v := range model {
+		if it.Search(iv.start, iv.end) != v {
+			t.Fatalf("Search %v: expected %v", iv, v)
+		}
+	}
+}
+
+func TestIntervalTreeStab(t *testing.T) {
+	it := NewInterval()
+	it.Insert(key(1), key(5), "a")
+	it.Insert(key(1), key(3), "b")
+	it.Insert(key(3), key(8), "c")
+	it.Insert(key(6), key(7), "d")
+	expected := "[{1 3 b} {1 5 a} {3 8 c}]"
+	if res := fmt.Sprint(it.Stab(key(2))); res != fmt.Sprint(it.Overlap(key(2), key(3))) || res != "[{1 3 b} {1 5 a}]" {
+		t.Errorf("Stab: expected [{1 3 b} {1 5 a}], actual %v", res)
+	}
+	if res := fmt.Sprint(it.Overlap(key(2), key(4))); res != expected {
+		t.Errorf("Overlap: expected %v, actual %v", expected, res)
+	}
+	if res := it.Stab(key(8)); len(res) != 0 {
+		t.Errorf("Stab: expected none, actual %v", res)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Insert: expected panic on empty interval")
+		}
+	}()
+	it.Insert(key(3), key(3), "e")
+}
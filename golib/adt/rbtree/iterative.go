@@ -0,0 +1,194 @@
+package rbtree
+
+import (
+	"github.com/atriw/lib/golib/adt"
+)
+
+// stackSize is the initial capacity of path stacks on the goroutine stack, enough for 2^32 keys.
+const stackSize = 64
+
+// step is a node on the path from the root, and whether the path goes to its left child.
+type step struct {
+	n    *llrbNode
+	left bool
+}
+
+// link sets the child of s.n the path goes to, and skips the write if it is already child.
+func (s step) link(child *llrbNode) {
+	if s.left {
+		if s.n.left != child {
+			s.n.left = child
+		}
+	} else if s.n.right != child {
+		s.n.right = child
+	}
+}
+
+func (t *LLRBTree) searchIter(key adt.Key) interface{} {
+	n := t.root
+	for n != nil {
+		if key.Equal(n.Key) {
+			return n.Value
+		}
+		if key.Less(n.Key) {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return nil
+}
+
+// climb links child to the last node of path, and balances the nodes from the bottom up like returning from recursion.
+// It returns the new root.
+func (t *LLRBTree) climb(path []step, child *llrbNode) *llrbNode {
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].link(child)
+		child = t.balance(path[i].n)
+	}
+	return child
+}
+
+// climbInsert is climb after inserting a node bottom up. Once a black node keeps its place and color,
+// the nodes above keep their shape, so it only updates their sizes and summaries.
+func (t *LLRBTree) climbInsert(path []step, child *llrbNode) *llrbNode {
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i].n
+		path[i].link(child)
+		color := n.color
+		child = t.balance(n)
+		if child == n && color == colorBlack && n.color == colorBlack {
+			return t.resize(path, i, true)
+		}
+	}
+	return child
+}
+
+// resize updates the sizes and summaries of the nodes of path above the ith, which keep their shape,
+// and returns the root.
+func (t *LLRBTree) resize(path []step, i int, added bool) *llrbNode {
+	if t.monoid != nil || added {
+		for i--; i >= 0; i-- {
+			if t.monoid != nil {
+				t.update(path[i].n)
+			} else {
+				path[i].n.n++
+			}
+		}
+	}
+	return path[0].n
+}
+
+func (t *LLRBTree) insertIter(key adt.Key, value interface{}) *llrbNode {
+	var stack [stackSize]step
+	path := stack[:0]
+	n := t.root
+	for n != nil {
+		n = t.own(n)
+		if t.persistent && len(path) > 0 {
+			// Link copies on the way down, as climbInsert may stop early.
+			path[len(path)-1].link(n)
+		}
+		if t.topDown && n.left.isRed() && n.right.isRed() {
+			t.flipColor(n)
+		}
+		if key.Equal(n.Key) {
+			n.Value = value
+			if t.topDown {
+				return t.climb(path, t.balance(n))
+			}
+			t.update(n)
+			return t.resize(append(path, step{n: n}), len(path), false)
+		}
+		left := key.Less(n.Key)
+		path = append(path, step{n: n, left: left})
+		if left {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	n = &llrbNode{Key: key, Value: value, color: colorRed, gen: t.gen}
+	t.update(n)
+	if t.topDown {
+		return t.climb(path, n)
+	}
+	return t.climbInsert(path, n)
+}
+
+func (t *LLRBTree) deleteIter(key adt.Key, deleted *llrbNode) *llrbNode {
+	var stack [stackSize]step
+	path := stack[:0]
+	for n := t.root; n != nil; {
+		n = t.own(n)
+		if key.Less(n.Key) {
+			if !n.left.isRed() && n.left != nil && !n.left.left.isRed() {
+				n = t.moveRedLeft(n)
+			}
+			path = append(path, step{n: n, left: true})
+			n = n.left
+			continue
+		}
+		if n.left.isRed() && !t.is4Node(n) {
+			n = t.rightRotate(n)
+		}
+		if key.Equal(n.Key) && n.right == nil {
+			*deleted = *n
+			break
+		}
+		if !n.right.isRed() && n.right != nil && !n.right.left.isRed() {
+			n = t.moveRedRight(n)
+		}
+		path = append(path, step{n: n, left: false})
+		if key.Equal(n.Key) {
+			var min llrbNode
+			path = t.pathToMin(path, n.right, &min)
+			deleted.Value = n.Value
+			n.Key = min.Key
+			n.Value = min.Value
+			break
+		}
+		n = n.right
+	}
+	return t.climb(path, nil)
+}
+
+// pathToMin appends the path of deleteMin from n, and returns it with the min entry copied to min.
+func (t *LLRBTree) pathToMin(path []step, n *llrbNode, min *llrbNode) []step {
+	for n.left != nil {
+		n = t.own(n)
+		if !n.left.isRed() && !n.left.left.isRed() {
+			n = t.moveRedLeft(n)
+		}
+		path = append(path, step{n: n, left: true})
+		n = n.left
+	}
+	*min = *n
+	return path
+}
+
+func (t *LLRBTree) deleteMinIter(min *llrbNode) *llrbNode {
+	var stack [stackSize]step
+	return t.climb(t.pathToMin(stack[:0], t.root, min), nil)
+}
+
+func (t *LLRBTree) deleteMaxIter(max *llrbNode) *llrbNode {
+	var stack [stackSize]step
+	path := stack[:0]
+	for n := t.root; ; {
+		n = t.own(n)
+		if n.left.isRed() && !t.is4Node(n) {
+			n = t.rightRotate(n)
+		}
+		if n.right == nil {
+			*max = *n
+			break
+		}
+		if !n.right.isRed() && !n.right.left.isRed() {
+			n = t.moveRedRight(n)
+		}
+		path = append(path, step{n: n, left: false})
+		n = n.right
+	}
+	return t.climb(path, nil)
+}
@@ -14,6 +14,10 @@ type llrbNode struct {
 	right *llrbNode
 	color color
 	n     int
+	// aug is the summary of the subtree if LLRBTree has a monoid.
+	aug interface{}
+	// gen is the generation of the persistent tree version that created the node.
+	gen uint64
 }
 
 func (n *llrbNode) size() int {
@@ -54,14 +58,28 @@ func (n *llrbNode) External() bool {
 }
 
 type LLRBTree struct {
-	root *llrbNode
+	root   *llrbNode
+	monoid *Monoid
+	// persistent makes modifications copy nodes not created in generation gen instead of changing them.
+	persistent bool
+	gen        uint64
+	// topDown selects the 2-3-4 insertion, which splits 4-nodes on the way down and keeps them otherwise.
+	topDown   bool
+	iterative bool
 }
 
-func NewLL() *LLRBTree {
-	return &LLRBTree{root: nil}
+func NewLL(opts ...Option) *LLRBTree {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &LLRBTree{root: nil, monoid: o.monoid, topDown: o.topDown, iterative: o.iterative}
 }
 
 func (t *LLRBTree) Search(key adt.Key) interface{} {
+	if t.iterative {
+		return t.searchIter(key)
+	}
 	return t.search(t.root, key)
 }
 
@@ -79,13 +97,23 @@ func (t *LLRBTree) search(n *llrbNode, key adt.Key) interface{} {
 }
 
 func (t *LLRBTree) Insert(key adt.Key, value interface{}) {
-	t.root = t.insert(t.root, key, value)
+	if t.iterative {
+		t.root = t.insertIter(key, value)
+	} else {
+		t.root = t.insert(t.root, key, value)
+	}
 	t.root.color = colorBlack
 }
 
 func (t *LLRBTree) insert(n *llrbNode, key adt.Key, value interface{}) *llrbNode {
 	if n == nil {
-		return &llrbNode{Key: key, Value: value, color: colorRed, n: 1}
+		n := &llrbNode{Key: key, Value: value, color: colorRed, gen: t.gen}
+		t.update(n)
+		return n
+	}
+	n = t.own(n)
+	if t.topDown && n.left.isRed() && n.right.isRed() {
+		t.flipColor(n)
 	}
 	if key.Equal(n.Key) {
 		n.Value = value
@@ -101,35 +129,57 @@ func (t *LLRBTree) insert(n *llrbNode, key adt.Key, value interface{}) *llrbNode
 	if n.left.isRed() && n.left.left.isRed() {
 		n = t.rightRotate(n)
 	}
-	if n.left.isRed() && n.right.isRed() {
+	if !t.topDown && n.left.isRed() && n.right.isRed() {
 		t.flipColor(n)
 	}
 
-	n.n = n.left.size() + n.right.size() + 1
+	t.update(n)
 	return n
 }
 
+// update recomputes the size and the summary of n from its children.
+func (t *LLRBTree) update(n *llrbNode) {
+	n.n = n.left.size() + n.right.size() + 1
+	if t.monoid != nil {
+		n.aug = t.monoid.summarize(t.summary(n.left), n.Key, n.Value, t.summary(n.right))
+	}
+}
+
+// own returns n if it can be changed, or a copy of n owned by the current generation.
+func (t *LLRBTree) own(n *llrbNode) *llrbNode {
+	if !t.persistent || n == nil || n.gen == t.gen {
+		return n
+	}
+	c := *n
+	c.gen = t.gen
+	return &c
+}
+
 func (t *LLRBTree) leftRotate(n *llrbNode) *llrbNode {
-	r := n.right
+	n = t.own(n)
+	r := t.own(n.right)
 	n.right = r.left
 	r.left = n
 	n.color, r.color = r.color, n.color
-	r.n = n.n
-	n.n = n.left.size() + n.right.size() + 1
+	t.update(n)
+	t.update(r)
 	return r
 }
 
 func (t *LLRBTree) rightRotate(n *llrbNode) *llrbNode {
-	l := n.left
+	n = t.own(n)
+	l := t.own(n.left)
 	n.left = l.right
 	l.right = n
 	n.color, l.color = l.color, n.color
-	l.n = n.n
-	n.n = n.left.size() + n.right.size() + 1
+	t.update(n)
+	t.update(l)
 	return l
 }
 
+// flipColor can only be called on owned node.
 func (t *LLRBTree) flipColor(n *llrbNode) {
+	n.left, n.right = t.own(n.left), t.own(n.right)
 	n.left.color = complement(n.left.color)
 	n.right.color = complement(n.right.color)
 	n.color = complement(n.color)
@@ -139,11 +189,16 @@ func (t *LLRBTree) Delete(key adt.Key) interface{} {
 	if t.root == nil {
 		return nil
 	}
+	t.root = t.own(t.root)
 	if !t.root.left.isRed() && t.root.right.isRed() {
 		t.root.color = colorRed
 	}
 	deleted := &llrbNode{}
-	t.root = t.delete(t.root, key, deleted)
+	if t.iterative {
+		t.root = t.deleteIter(key, deleted)
+	} else {
+		t.root = t.delete(t.root, key, deleted)
+	}
 	if t.root != nil {
 		t.root.color = colorBlack
 	}
@@ -154,13 +209,14 @@ func (t *LLRBTree) delete(n *llrbNode, key adt.Key, deleted *llrbNode) *llrbNode
 	if n == nil {
 		return nil
 	}
+	n = t.own(n)
 	if key.Less(n.Key) {
 		if !n.left.isRed() && n.left != nil && !n.left.left.isRed() {
 			n = t.moveRedLeft(n)
 		}
 		n.left = t.delete(n.left, key, deleted)
 	} else {
-		if n.left.isRed() {
+		if n.left.isRed() && !t.is4Node(n) {
 			n = t.rightRotate(n)
 		}
 		if key.Equal(n.Key) && n.right == nil {
@@ -187,12 +243,17 @@ func (t *LLRBTree) DeleteMin() (adt.Key, interface{}) {
 	if t.root == nil {
 		return nil, nil
 	}
+	t.root = t.own(t.root)
 	if !t.root.left.isRed() {
 		// Invariant: current node is not 2-node.
 		t.root.color = colorRed
 	}
 	min := &llrbNode{}
-	t.root = t.deleteMin(t.root, min)
+	if t.iterative {
+		t.root = t.deleteMinIter(min)
+	} else {
+		t.root = t.deleteMin(t.root, min)
+	}
 	if t.root != nil {
 		t.root.color = colorBlack
 	}
@@ -204,6 +265,7 @@ func (t *LLRBTree) deleteMin(n *llrbNode, min *llrbNode) *llrbNode {
 		*min = *n
 		return nil
 	}
+	n = t.own(n)
 	if !n.left.isRed() && !n.left.left.isRed() {
 		n = t.moveRedLeft(n)
 	}
@@ -215,11 +277,16 @@ func (t *LLRBTree) DeleteMax() (adt.Key, interface{}) {
 	if t.root == nil {
 		return nil, nil
 	}
+	t.root = t.own(t.root)
 	if !t.root.left.isRed() {
 		t.root.color = colorRed
 	}
 	max := &llrbNode{}
-	t.root = t.deleteMax(t.root, max)
+	if t.iterative {
+		t.root = t.deleteMaxIter(max)
+	} else {
+		t.root = t.deleteMax(t.root, max)
+	}
 	if t.root != nil {
 		t.root.color = colorBlack
 	}
@@ -227,7 +294,8 @@ func (t *LLRBTree) DeleteMax() (adt.Key, interface{}) {
 }
 
 func (t *LLRBTree) deleteMax(n *llrbNode, max *llrbNode) *llrbNode {
-	if n.left.isRed() {
+	n = t.own(n)
+	if n.left.isRed() && !t.is4Node(n) {
 		// Make 3-node right-leaned.
 		n = t.rightRotate(n)
 	}
@@ -235,7 +303,7 @@ func (t *LLRBTree) deleteMax(n *llrbNode, max *llrbNode) *llrbNode {
 		*max = *n
 		return nil
 	}
-	if !n.right.isRed() && n.right.left.isRed() {
+	if !n.right.isRed() && !n.right.left.isRed() {
 		n = t.moveRedRight(n)
 	}
 	n.right = t.deleteMax(n.right, max)
@@ -260,10 +328,19 @@ func (t *LLRBTree) moveRedLeft(n *llrbNode) *llrbNode {
 		n.right = t.rightRotate(n.right)
 		n = t.leftRotate(n)
 		t.flipColor(n)
+		if n.right.right.isRed() {
+			// The rest of a 4-node leans right.
+			n.right = t.leftRotate(n.right)
+		}
 	}
 	return n
 }
 
+// is4Node reports whether n is a 4-node kept by the 2-3-4 insertion, whose right red link is already there.
+func (t *LLRBTree) is4Node(n *llrbNode) bool {
+	return t.topDown && n.left.isRed() && n.right.isRed()
+}
+
 func (t *LLRBTree) moveRedRight(n *llrbNode) *llrbNode {
 	//     n(r)                n(b)
 	//    /  \                /  \
@@ -289,6 +366,7 @@ func (t *LLRBTree) balance(n *llrbNode) *llrbNode {
 	if n == nil {
 		return nil
 	}
+	n = t.own(n)
 
 	if n.right.isRed() && !n.left.isRed() {
 		// Make right-leaned red link left-leaned.
@@ -298,14 +376,162 @@ func (t *LLRBTree) balance(n *llrbNode) *llrbNode {
 		// Make doulbe red link a 4-node.
 		n = t.rightRotate(n)
 	}
-	if n.left.isRed() && n.right.isRed() {
-		// Split 4-node.
+	if n.left.isRed() && n.right.isRed() && !t.topDown {
+		// Split 4-node, which 2-3-4 trees keep.
 		t.flipColor(n)
 	}
-	n.n = n.left.size() + n.right.size() + 1
+	t.update(n)
 	return n
 }
 
+// DeleteRange removes all keys in [lo, hi), and returns the number of removed keys, and the removed entries if collect.
+// Like RBTree.DeleteRange, it splits the tree at lo and hi, and joins the outer trees once.
+func (t *LLRBTree) DeleteRange(lo, hi adt.Key, collect bool) (int, []adt.Entry) {
+	if !lo.Less(hi) || t.root == nil {
+		return 0, nil
+	}
+	l, lh, m, mh := t.split(t.root, t.root.spineBlackHeight(), lo)
+	m, _, r, rh := t.split(m, mh, hi)
+	var entries []adt.Entry
+	if collect {
+		m.inorder(&entries)
+	}
+	t.root = t.own(t.join2(l, lh, r, rh))
+	if t.root != nil {
+		t.root.color = colorBlack
+	}
+	return m.size(), entries
+}
+
+// spineBlackHeight returns the black height of a valid tree by its left spine.
+func (n *llrbNode) spineBlackHeight() int {
+	h := 0
+	for ; n != nil; n = n.left {
+		if !n.isRed() {
+			h++
+		}
+	}
+	return h
+}
+
+func (n *llrbNode) inorder(entries *[]adt.Entry) {
+	if n == nil {
+		return
+	}
+	n.left.inorder(entries)
+	*entries = append(*entries, adt.Entry{Key: n.Key, Value: n.Value})
+	n.right.inorder(entries)
+}
+
+// split splits the tree n of black height h into trees of keys less than key and the others,
+// and returns their roots and black heights.
+func (t *LLRBTree) split(n *llrbNode, h int, key adt.Key) (l *llrbNode, lh int, r *llrbNode, rh int) {
+	if n == nil {
+		return nil, 0, nil, 0
+	}
+	ch := h
+	if !n.isRed() {
+		ch--
+	}
+	if key.Less(n.Key) || key.Equal(n.Key) {
+		l, lh, r, rh = t.split(n.left, ch, key)
+		r, rh = t.join(r, rh, n, n.right, ch)
+		return l, lh, r, rh
+	}
+	l, lh, r, rh = t.split(n.right, ch, key)
+	l, lh = t.join(n.left, ch, n, l, lh)
+	return l, lh, r, rh
+}
+
+// join joins the trees l, r of black heights lh, rh and the node k, where keys of l < k.Key < keys of r.
+// It links k as a red node in the spine of the higher tree where the black heights meet,
+// balances back up like an insertion, and returns the root and black height of the joined tree.
+func (t *LLRBTree) join(l *llrbNode, lh int, k *llrbNode, r *llrbNode, rh int) (*llrbNode, int) {
+	if l.isRed() {
+		l = t.own(l)
+		l.color = colorBlack
+		lh++
+	}
+	if r.isRed() {
+		r = t.own(r)
+		r.color = colorBlack
+		rh++
+	}
+	var n *llrbNode
+	h := lh
+	if lh >= rh {
+		n = t.joinRight(l, lh, k, r, rh)
+	} else {
+		n, h = t.joinLeft(l, lh, k, r, rh), rh
+	}
+	if n.isRed() {
+		n.color = colorBlack
+		h++
+	}
+	return n, h
+}
+
+func (t *LLRBTree) joinRight(n *llrbNode, h int, k *llrbNode, r *llrbNode, rh int) *llrbNode {
+	if h == rh && !n.isRed() {
+		k = t.own(k)
+		k.left, k.right, k.color = n, r, colorRed
+		t.update(k)
+		return k
+	}
+	n = t.own(n)
+	if t.is4Node(n) {
+		// Split 4-node on the way down like the 2-3-4 insertion.
+		t.flipColor(n)
+	}
+	if !n.isRed() {
+		h--
+	}
+	n.right = t.joinRight(n.right, h, k, r, rh)
+	return t.balance(n)
+}
+
+func (t *LLRBTree) joinLeft(l *llrbNode, lh int, k *llrbNode, n *llrbNode, h int) *llrbNode {
+	if h == lh && !n.isRed() {
+		k = t.own(k)
+		k.left, k.right, k.color = l, n, colorRed
+		t.update(k)
+		return k
+	}
+	n = t.own(n)
+	if t.is4Node(n) {
+		// Split 4-node on the way down like the 2-3-4 insertion.
+		t.flipColor(n)
+	}
+	if !n.isRed() {
+		h--
+	}
+	n.left = t.joinLeft(l, lh, k, n.left, h)
+	return t.balance(n)
+}
+
+// join2 joins the trees l, r of black heights lh, rh, where keys of l < keys of r.
+func (t *LLRBTree) join2(l *llrbNode, lh int, r *llrbNode, rh int) *llrbNode {
+	if r == nil {
+		return l
+	}
+	if l == nil {
+		return r
+	}
+	// Delete the minimum of r and use it to join.
+	r = t.own(r)
+	if !r.left.isRed() {
+		r.color = colorRed
+	}
+	min := &llrbNode{}
+	r = t.deleteMin(r, min)
+	if r != nil {
+		r = t.own(r)
+		r.color = colorBlack
+	}
+	root, _ := t.join(l, lh, min, r, r.spineBlackHeight())
+	return root
+}
+
 func (t *LLRBTree) Length() int {
 	return t.root.size()
 }
@@ -315,7 +541,19 @@ func (t *LLRBTree) String() string {
 }
 
 func (t *LLRBTree) Validate() bool {
-	return t.root.propertyRedHasNoRedChildren() && t.root.propertyBlackHeightEqual()
+	return t.root.propertyRedHasNoRedChildren() && t.root.propertyBlackHeightEqual() && t.validateSummary(t.root) &&
+		t.root.propertyLeftLeaning(t.topDown)
+}
+
+// propertyLeftLeaning checks that red links lean left, except for 4-nodes if they are allowed.
+func (n *llrbNode) propertyLeftLeaning(allow4 bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.right.isRed() && !(allow4 && n.left.isRed()) {
+		return false
+	}
+	return n.left.propertyLeftLeaning(allow4) && n.right.propertyLeftLeaning(allow4)
 }
 
 func (n *llrbNode) propertyRedHasNoRedChildren() bool {
@@ -1,6 +1,7 @@
 package rbtree_test
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/atriw/lib/golib/adt"
@@ -15,3 +16,77 @@ func TestLLRBTree(t *testing.T) {
 func BenchmarkLLRBTreeSearch(b *testing.B) {
 	adt.XBenchSearch(b, func() adt.ADT { return NewLL() })
 }
+
+func TestLLRBTreeDeleteRange(t *testing.T) {
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return NewLL() })
+}
+
+// TestLLRBTreeDeleteMax drains the tree from the max, which needs to move red links to the right.
+func TestLLRBTreeDeleteMax(t *testing.T) {
+	rbt := NewLL()
+	for _, i := range rand.Perm(200) {
+		rbt.Insert(key(i), i)
+	}
+	for i := 199; i >= 0; i-- {
+		k, v := rbt.DeleteMax()
+		if k != key(i) || v != i {
+			t.Fatalf("DeleteMax: expected %v, actual %v %v", i, k, v)
+		}
+		if !rbt.Validate() {
+			t.Fatalf("DeleteMax: broken tree after deleting %v", i)
+		}
+	}
+	if k, _ := rbt.DeleteMax(); k != nil || rbt.Length() != 0 {
+		t.Errorf("DeleteMax: expected empty tree, actual %v, length %v", k, rbt.Length())
+	}
+}
+
+func TestLLRBTreeTopDown234(t *testing.T) {
+	rbt := NewLL(WithTopDown234())
+	adt.XTestADT(t, rbt)
+	xTestMultiWay(t, NewLL(WithTopDown234()), 3)
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return NewLL(WithTopDown234()) })
+	xTestAggregate(t, func(m Monoid) aggregator { return NewLL(WithTopDown234(), WithMonoid(m)) })
+}
+
+func TestLLRBTreeIterative(t *testing.T) {
+	adt.XTestADT(t, NewLL(WithIterative()))
+	xTestAggregate(t, func(m Monoid) aggregator { return NewLL(WithIterative(), WithMonoid(m)) })
+	for _, opts := range [][]Option{nil, {WithTopDown234()}} {
+		recursive, iterative := NewLL(opts...), NewLL(append(opts, WithIterative())...)
+		for i := 0; i < 5000; i++ {
+			k := key(rand.Intn(1000))
+			switch rand.Intn(8) {
+			case 0:
+				recursive.DeleteMin()
+				iterative.DeleteMin()
+			case 1:
+				recursive.DeleteMax()
+				iterative.DeleteMax()
+			case 2, 3, 4:
+				if v1, v2 := recursive.Delete(k), iterative.Delete(k); v1 != v2 {
+					t.Fatalf("Delete %v: expected %v, actual %v", k, v1, v2)
+				}
+			default:
+				recursive.Insert(k, i)
+				iterative.Insert(k, i)
+			}
+			if iterative.Search(k) != recursive.Search(k) {
+				t.Fatalf("Search %v: expected %v, actual %v", k, recursive.Search(k), iterative.Search(k))
+			}
+		}
+		if !iterative.Validate() {
+			t.Fatalf("Validate: invalid tree")
+		}
+		if recursive.String() != iterative.String() {
+			t.Fatalf("Iterative: expected the same shape\n%v\nactual\n%v", recursive, iterative)
+		}
+	}
+}
+
+func BenchmarkLLRBTreeIterative(b *testing.B) {
+	adt.XBenchInsert(b, func() adt.ADT { return NewLL() })
+	adt.XBenchInsert(b, func() adt.ADT { return NewLL(WithIterative()) })
+	adt.XBenchDelete(b, func() adt.ADT { return NewLL() })
+	adt.XBenchDelete(b, func() adt.ADT { return NewLL(WithIterative()) })
+}
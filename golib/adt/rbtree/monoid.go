@@ -0,0 +1,133 @@
+package rbtree
+
+import (
+	"reflect"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+// Monoid summarizes entries of subtrees, such as the sum or the max of values.
+// Combine must be associative, and Identity must be its identity element.
+type Monoid struct {
+	Identity interface{}
+	Combine  func(a, b interface{}) interface{}
+	// Measure returns the summary of a single entry.
+	Measure func(key adt.Key, value interface{}) interface{}
+}
+
+// summarize combines the summaries of the left subtree, the entry and the right subtree in key order.
+func (m *Monoid) summarize(left interface{}, key adt.Key, value interface{}, right interface{}) interface{} {
+	return m.Combine(m.Combine(left, m.Measure(key, value)), right)
+}
+
+func (t *RBTree) summary(n *node) interface{} {
+	if n.isExternal() {
+		return t.monoid.Identity
+	}
+	return n.aug
+}
+
+// Aggregate returns the combined summary of entries in [lo, hi) in key order, a nil bound means unbounded.
+// It panics if the tree has no monoid.
+func (t *RBTree) Aggregate(lo, hi adt.Key) interface{} {
+	if t.monoid == nil {
+		panic("aggregate without monoid")
+	}
+	return t.aggregate(t.root, lo, hi)
+}
+
+func (t *RBTree) aggregate(n *node, lo, hi adt.Key) interface{} {
+	for !n.isExternal() {
+		if lo != nil && n.Key.Less(lo) {
+			n = n.right
+		} else if hi != nil && !n.Key.Less(hi) {
+			n = n.left
+		} else if lo == nil && hi == nil {
+			return n.aug
+		} else {
+			return t.monoid.summarize(t.aggregate(n.left, lo, nil), n.Key, n.Value, t.aggregate(n.right, nil, hi))
+		}
+	}
+	return t.monoid.Identity
+}
+
+// validateSummary recomputes summaries from scratch and compares them to the kept ones.
+func (t *RBTree) validateSummary(n *node) bool {
+	if t.monoid == nil {
+		return true
+	}
+	_, ok := t.recompute(n)
+	return ok
+}
+
+func (t *RBTree) recompute(n *node) (interface{}, bool) {
+	if n.isExternal() {
+		return t.monoid.Identity, true
+	}
+	l, ok := t.recompute(n.left)
+	if !ok {
+		return nil, false
+	}
+	r, ok := t.recompute(n.right)
+	if !ok {
+		return nil, false
+	}
+	s := t.monoid.summarize(l, n.Key, n.Value, r)
+	return s, reflect.DeepEqual(s, n.aug)
+}
+
+func (t *LLRBTree) summary(n *llrbNode) interface{} {
+	if n == nil {
+		return t.monoid.Identity
+	}
+	return n.aug
+}
+
+// Aggregate returns the combined summary of entries in [lo, hi) in key order, a nil bound means unbounded.
+// It panics if the tree has no monoid.
+func (t *LLRBTree) Aggregate(lo, hi adt.Key) interface{} {
+	if t.monoid == nil {
+		panic("aggregate without monoid")
+	}
+	return t.aggregate(t.root, lo, hi)
+}
+
+func (t *LLRBTree) aggregate(n *llrbNode, lo, hi adt.Key) interface{} {
+	for n != nil {
+		if lo != nil && n.Key.Less(lo) {
+			n = n.right
+		} else if hi != nil && !n.Key.Less(hi) {
+			n = n.left
+		} else if lo == nil && hi == nil {
+			return n.aug
+		} else {
+			return t.monoid.summarize(t.aggregate(n.left, lo, nil), n.Key, n.Value, t.aggregate(n.right, nil, hi))
+		}
+	}
+	return t.monoid.Identity
+}
+
+// validateSummary recomputes summaries from scratch and compares them to the kept ones.
+func (t *LLRBTree) validateSummary(n *llrbNode) bool {
+	if t.monoid == nil {
+		return true
+	}
+	_, ok := t.recompute(n)
+	return ok
+}
+
+func (t *LLRBTree) recompute(n *llrbNode) (interface{}, bool) {
+	if n == nil {
+		return t.monoid.Identity, true
+	}
+	l, ok := t.recompute(n.left)
+	if !ok {
+		return nil, false
+	}
+	r, ok := t.recompute(n.right)
+	if !ok {
+		return nil, false
+	}
+	s := t.monoid.summarize(l, n.Key, n.Value, r)
+	return s, reflect.DeepEqual(s, n.aug)
+}
@@ -0,0 +1,92 @@
+package rbtree_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/rbtree"
+)
+
+type aggregator interface {
+	adt.RangeDeleter
+	Aggregate(lo, hi adt.Key) interface{}
+	Validate() bool
+}
+
+// keys concatenates keys in order, which is not commutative.
+var keys = Monoid{
+	Identity: "",
+	Combine:  func(a, b interface{}) interface{} { return a.(string) + b.(string) },
+	Measure:  func(k adt.Key, _ interface{}) interface{} { return fmt.Sprint(k, ",") },
+}
+
+var sum = Monoid{
+	Identity: 0,
+	Combine:  func(a, b interface{}) interface{} { return a.(int) + b.(int) },
+	Measure:  func(_ adt.Key, v interface{}) interface{} { return v.(int) },
+}
+
+func xTestAggregate(t *testing.T, newTree func(Monoid) aggregator) {
+	kt, st := newTree(keys), newTree(sum)
+	model := make(map[int]int)
+	for i := 0; i < 3000; i++ {
+		k := rand.Intn(500)
+		switch rand.Intn(10) {
+		case 0:
+			hi := k + rand.Intn(20)
+			kt.DeleteRange(key(k), key(hi), false)
+			st.DeleteRange(key(k), key(hi), false)
+			for j := k; j < hi; j++ {
+				delete(model, j)
+			}
+		case 1, 2, 3:
+			kt.Delete(key(k))
+			st.Delete(key(k))
+			delete(model, k)
+		default:
+			kt.Insert(key(k), i)
+			st.Insert(key(k), i)
+			model[k] = i
+		}
+		if i%100 != 0 {
+			continue
+		}
+		if !kt.Validate() || !st.Validate() {
+			t.Fatalf("Validate: invalid summaries")
+		}
+		for q := 0; q < 10; q++ {
+			lo := rand.Intn(520)
+			hi := lo + rand.Intn(100)
+			expectedKeys, expectedSum := "", 0
+			for j := lo; j < hi; j++ {
+				if v, ok := model[j]; ok {
+					expectedKeys += fmt.Sprint(j, ",")
+					expectedSum += v
+				}
+			}
+			if actual := kt.Aggregate(key(lo), key(hi)); actual != expectedKeys {
+				t.Fatalf("Aggregate [%v, %v): expected %q, actual %q", lo, hi, expectedKeys, actual)
+			}
+			if actual := st.Aggregate(key(lo), key(hi)); actual != expectedSum {
+				t.Fatalf("Aggregate [%v, %v): expected %v, actual %v", lo, hi, expectedSum, actual)
+			}
+		}
+	}
+	total := 0
+	for _, v := range model {
+		total += v
+	}
+	if actual := st.Aggregate(nil, nil); actual != total {
+		t.Errorf("Aggregate: expected %v, actual %v", total, actual)
+	}
+}
+
+func TestRBTreeAggregate(t *testing.T) {
+	xTestAggregate(t, func(m Monoid) aggregator { return New(WithMonoid(m)) })
+}
+
+func TestLLRBTreeAggregate(t *testing.T) {
+	xTestAggregate(t, func(m Monoid) aggregator { return NewLL(WithMonoid(m)) })
+}
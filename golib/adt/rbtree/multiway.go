@@ -0,0 +1,105 @@
+package rbtree
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+// redBlackNode is a node of RBTree or LLRBTree.
+type redBlackNode interface {
+	adt.TreeNode
+	isRed() bool
+	entry() (adt.Key, interface{})
+}
+
+func (n *node) entry() (adt.Key, interface{}) {
+	return n.Key, n.Value
+}
+
+func (n *llrbNode) entry() (adt.Key, interface{}) {
+	return n.Key, n.Value
+}
+
+// MultiWayNode is a black node with its red children folded in.
+// Folding a RBTree gives a 2-3-4 tree, and folding a LLRBTree gives a 2-3 tree,
+// or a 2-3-4 tree with WithTopDown234.
+type MultiWayNode struct {
+	keys     []adt.Key
+	values   []interface{}
+	children []*MultiWayNode
+}
+
+func newMultiWayNode(n redBlackNode) *MultiWayNode {
+	m := &MultiWayNode{}
+	if !n.External() {
+		m.fold(n.Left().(redBlackNode))
+		k, v := n.entry()
+		m.keys, m.values = append(m.keys, k), append(m.values, v)
+		m.fold(n.Right().(redBlackNode))
+	}
+	return m
+}
+
+// fold appends the child n, or the entries and children of n if it is red.
+func (m *MultiWayNode) fold(n redBlackNode) {
+	if n.External() {
+		return
+	}
+	if !n.isRed() {
+		m.children = append(m.children, newMultiWayNode(n))
+		return
+	}
+	m.fold(n.Left().(redBlackNode))
+	k, v := n.entry()
+	m.keys, m.values = append(m.keys, k), append(m.values, v)
+	m.fold(n.Right().(redBlackNode))
+}
+
+// Keys returns the keys of the node in order.
+func (m *MultiWayNode) Keys() []adt.Key {
+	return m.keys
+}
+
+func (m *MultiWayNode) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[<%v>", len(m.keys)+1))
+	for i := range m.keys {
+		sb.WriteString(fmt.Sprintf(":<%v:%v>", m.keys[i], m.values[i]))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+func (m *MultiWayNode) Iterator() adt.Iterator {
+	if len(m.children) == 0 {
+		return nil
+	}
+	return &multiWayIterator{nodes: m.children}
+}
+
+type multiWayIterator struct {
+	nodes []*MultiWayNode
+	idx   int
+}
+
+func (i *multiWayIterator) HasNext() bool {
+	return i.idx < len(i.nodes)
+}
+
+func (i *multiWayIterator) Next() adt.MultiWayTreeNode {
+	n := i.nodes[i.idx]
+	i.idx++
+	return n
+}
+
+// MultiWay returns the equivalent 2-3-4 tree, to print by adt.PrintMultiWayTree.
+func (t *RBTree) MultiWay() *MultiWayNode {
+	return newMultiWayNode(t.root)
+}
+
+// MultiWay returns the equivalent 2-3 tree, or 2-3-4 tree with WithTopDown234, to print by adt.PrintMultiWayTree.
+func (t *LLRBTree) MultiWay() *MultiWayNode {
+	return newMultiWayNode(t.root)
+}
@@ -0,0 +1,70 @@
+package rbtree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/rbtree"
+)
+
+// checkMultiWay checks that m is a B-tree with at most maxKeys keys per node,
+// and returns its keys in order and its height.
+func checkMultiWay(t *testing.T, m *MultiWayNode, maxKeys int) ([]adt.Key, int) {
+	t.Helper()
+	if n := len(m.Keys()); n < 1 || n > maxKeys {
+		t.Fatalf("MultiWay: %v keys in %v", n, m)
+	}
+	it := m.Iterator()
+	if it == nil {
+		return m.Keys(), 1
+	}
+	var keys []adt.Key
+	height, i := -1, 0
+	for ; it.HasNext(); i++ {
+		ks, h := checkMultiWay(t, it.Next().(*MultiWayNode), maxKeys)
+		if height >= 0 && h != height {
+			t.Fatalf("MultiWay: leaves of different depths under %v", m)
+		}
+		height = h
+		keys = append(keys, ks...)
+		if i < len(m.Keys()) {
+			keys = append(keys, m.Keys()[i])
+		}
+	}
+	if i != len(m.Keys())+1 {
+		t.Fatalf("MultiWay: %v children of %v", i, m)
+	}
+	return keys, height + 1
+}
+
+func xTestMultiWay(t *testing.T, tree interface {
+	adt.ADT
+	MultiWay() *MultiWayNode
+}, maxKeys int) {
+	for i := 0; i < 2000; i++ {
+		if k := key(rand.Intn(500)); rand.Intn(3) == 0 {
+			tree.Delete(k)
+		} else {
+			tree.Insert(k, nil)
+		}
+	}
+	keys, _ := checkMultiWay(t, tree.MultiWay(), maxKeys)
+	if len(keys) != tree.Length() {
+		t.Fatalf("MultiWay: expected %v keys, actual %v", tree.Length(), len(keys))
+	}
+	for i := 1; i < len(keys); i++ {
+		if !keys[i-1].Less(keys[i]) {
+			t.Fatalf("MultiWay: unordered keys %v %v", keys[i-1], keys[i])
+		}
+	}
+	t.Log("\n" + adt.PrintMultiWayTreeDepth(tree.MultiWay(), 2))
+}
+
+func TestRBTreeMultiWay(t *testing.T) {
+	xTestMultiWay(t, New(), 3)
+}
+
+func TestLLRBTreeMultiWay(t *testing.T) {
+	xTestMultiWay(t, NewLL(), 2)
+}
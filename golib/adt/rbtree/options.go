@@ -0,0 +1,34 @@
+package rbtree
+
+type options struct {
+	monoid    *Monoid
+	topDown   bool
+	iterative bool
+}
+
+// Option is RBTree and LLRBTree initialization options
+type Option func(*options)
+
+// WithTopDown234 makes LLRBTree a 2-3-4 tree, which splits 4-nodes on the way down on insertion, as in Sedgewick's paper.
+// It only applies to NewLL.
+func WithTopDown234() Option {
+	return func(o *options) {
+		o.topDown = true
+	}
+}
+
+// WithMonoid makes the tree keep the summary of each subtree, so that Aggregate takes O(log n)
+func WithMonoid(m Monoid) Option {
+	return func(o *options) {
+		o.monoid = &m
+	}
+}
+
+// WithIterative makes LLRBTree search, insert and delete with loops and an explicit path stack instead of recursion.
+// The trees are of exactly the same shape as the recursive ones.
+// It only applies to NewLL.
+func WithIterative() Option {
+	return func(o *options) {
+		o.iterative = true
+	}
+}
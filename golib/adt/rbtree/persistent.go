@@ -0,0 +1,72 @@
+package rbtree
+
+import (
+	"sync/atomic"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+// generation numbers persistent tree versions, 0 is never used by a version.
+var generation uint64
+
+// PersistentLLRBTree is an immutable LLRBTree.
+// Modifications return a new version that shares all but O(log n) nodes with the old one,
+// and old versions stay valid, so they can be kept as snapshots and read concurrently without locks.
+type PersistentLLRBTree struct {
+	t LLRBTree
+}
+
+func NewPersistentLL(opts ...Option) *PersistentLLRBTree {
+	return &PersistentLLRBTree{t: *NewLL(opts...)}
+}
+
+// next returns a copy of the tree that copies nodes of older versions on modification.
+func (p *PersistentLLRBTree) next() *PersistentLLRBTree {
+	n := &PersistentLLRBTree{t: p.t}
+	n.t.persistent = true
+	n.t.gen = atomic.AddUint64(&generation, 1)
+	return n
+}
+
+// Insert returns a new version with key set to value.
+func (p *PersistentLLRBTree) Insert(key adt.Key, value interface{}) *PersistentLLRBTree {
+	n := p.next()
+	n.t.Insert(key, value)
+	return n
+}
+
+// Delete returns a new version without key, and the deleted value.
+func (p *PersistentLLRBTree) Delete(key adt.Key) (*PersistentLLRBTree, interface{}) {
+	n := p.next()
+	v := n.t.Delete(key)
+	return n, v
+}
+
+// DeleteRange returns a new version without keys in [lo, hi), and the number of removed keys,
+// and the removed entries if collect.
+func (p *PersistentLLRBTree) DeleteRange(lo, hi adt.Key, collect bool) (*PersistentLLRBTree, int, []adt.Entry) {
+	n := p.next()
+	num, entries := n.t.DeleteRange(lo, hi, collect)
+	return n, num, entries
+}
+
+func (p *PersistentLLRBTree) Search(key adt.Key) interface{} {
+	return p.t.Search(key)
+}
+
+func (p *PersistentLLRBTree) Length() int {
+	return p.t.Length()
+}
+
+// Aggregate is LLRBTree.Aggregate of this version.
+func (p *PersistentLLRBTree) Aggregate(lo, hi adt.Key) interface{} {
+	return p.t.Aggregate(lo, hi)
+}
+
+func (p *PersistentLLRBTree) String() string {
+	return p.t.String()
+}
+
+func (p *PersistentLLRBTree) Validate() bool {
+	return p.t.Validate()
+}
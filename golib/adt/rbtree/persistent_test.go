@@ -0,0 +1,95 @@
+package rbtree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/atriw/lib/golib/adt/rbtree"
+)
+
+func TestPersistentLLRBTree(t *testing.T) {
+	xTestPersistentLL(t, WithMonoid(sum))
+	xTestPersistentLL(t, WithMonoid(sum), WithIterative())
+}
+
+func xTestPersistentLL(t *testing.T, opts ...Option) {
+	type snapshot struct {
+		tree  *PersistentLLRBTree
+		model map[int]int
+	}
+	tree := NewPersistentLL(opts...)
+	model := make(map[int]int)
+	var snapshots []snapshot
+	for i := 0; i < 2000; i++ {
+		k := rand.Intn(300)
+		// Copy the model, the old one belongs to the previous snapshot.
+		next := make(map[int]int, len(model))
+		for k, v := range model {
+			next[k] = v
+		}
+		model = next
+		switch rand.Intn(8) {
+		case 0:
+			var num int
+			tree, num, _ = tree.DeleteRange(key(k), key(k+10), false)
+			for j := k; j < k+10; j++ {
+				if _, ok := model[j]; ok {
+					num--
+				}
+				delete(model, j)
+			}
+			if num != 0 {
+				t.Fatalf("DeleteRange: unexpected number of removed keys")
+			}
+		case 1, 2:
+			var v interface{}
+			tree, v = tree.Delete(key(k))
+			if expected, ok := model[k]; ok != (v != nil) || (ok && v != expected) {
+				t.Fatalf("Delete %v: expected %v, actual %v", k, expected, v)
+			}
+			delete(model, k)
+		default:
+			tree = tree.Insert(key(k), i)
+			model[k] = i
+		}
+		if i%20 == 0 {
+			snapshots = append(snapshots, snapshot{tree, model})
+		}
+	}
+	for _, s := range snapshots {
+		if !s.tree.Validate() {
+			t.Fatalf("Validate: invalid snapshot\n%v", s.tree)
+		}
+		if s.tree.Length() != len(s.model) {
+			t.Fatalf("Length: expected %v, actual %v", len(s.model), s.tree.Length())
+		}
+		total := 0
+		for k := 0; k < 300; k++ {
+			v := s.tree.Search(key(k))
+			if expected, ok := s.model[k]; ok != (v != nil) || (ok && v != expected) {
+				t.Fatalf("Search %v: expected %v, actual %v", k, expected, v)
+			}
+			total += s.model[k]
+		}
+		if s.tree.Aggregate(nil, nil) != total {
+			t.Fatalf("Aggregate: expected %v, actual %v", total, s.tree.Aggregate(nil, nil))
+		}
+	}
+}
+
+func TestPersistentLLRBTreeSharing(t *testing.T) {
+	tree := NewPersistentLL()
+	for i := 0; i < 1<<12; i++ {
+		tree = tree.Insert(key(i), i)
+	}
+	k := 1 << 12
+	allocs := testing.AllocsPerRun(100, func() {
+		tree.Insert(key(k), k)
+		tree.Delete(key(k / 2))
+	})
+	// A version copies O(log n) nodes rather than the tree.
+	if allocs > 200 {
+		t.Errorf("Insert and Delete: expected O(log n) allocations, actual %v", allocs)
+	}
+	t.Logf("%v allocations for an Insert and a Delete in a tree of %v keys", allocs, tree.Length())
+}
@@ -29,19 +29,19 @@ type node struct {
 	left   *node
 	right  *node
 	color  color
+	// aug is the augmentation of the subtree, maintained by RBTree.augment.
+	aug interface{}
 }
 
-func newInternalNode(key adt.Key, value interface{}) *node {
-	n := &node{Key: key, Value: value, color: colorRed}
-	e1 := newExternalNode(n)
-	e2 := newExternalNode(n)
-	n.left = e1
-	n.right = e2
-	return n
+// newInternalNode returns a red node whose children are the external sentinel.
+func newInternalNode(key adt.Key, value interface{}, sentinel *node) *node {
+	return &node{Key: key, Value: value, color: colorRed, left: sentinel, right: sentinel}
 }
 
-func newExternalNode(parent *node) *node {
-	return &node{parent: parent, color: colorBlack}
+// newSentinel returns the external node shared by all leaves of a tree.
+// Its parent is only meaningful right after it replaces a deleted node, during the deletion fix-up.
+func newSentinel() *node {
+	return &node{color: colorBlack}
 }
 
 func (n *node) isLeft() bool {
@@ -79,6 +79,11 @@ func (n *node) brother() *node {
 	return n.parent.left
 }
 
+// invalidate marks a removed node, it is external afterwards.
+func (n *node) invalidate() {
+	n.parent, n.left, n.right = nil, nil, nil
+}
+
 // successor can only be called on internal node.
 func (n *node) successor() *node {
 	succ := n.right
@@ -144,10 +149,28 @@ func (n *node) dir(dir direction) *node {
 type RBTree struct {
 	length int
 	root   *node
-}
-
-func New() *RBTree {
-	return &RBTree{root: newExternalNode(nil)}
+	// augment recomputes the augmentation of an internal node from its own and its children's, if not nil.
+	augment func(*node)
+	monoid  *Monoid
+	// sentinel is the external node shared by all leaves.
+	sentinel *node
+	// max is the node of the max key, or nil.
+	max *node
+}
+
+func New(opts ...Option) *RBTree {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	sentinel := newSentinel()
+	t := &RBTree{root: sentinel, sentinel: sentinel, monoid: o.monoid}
+	if m := t.monoid; m != nil {
+		t.augment = func(n *node) {
+			n.aug = m.summarize(t.summary(n.left), n.Key, n.Value, t.summary(n.right))
+		}
+	}
+	return t
 }
 
 func (t *RBTree) Length() int {
@@ -201,22 +224,41 @@ func (t *RBTree) search(key adt.Key) (p *node, dir direction) {
 
 func (t *RBTree) Insert(key adt.Key, value interface{}) {
 	p, dir := t.search(key)
+	t.insert(p, dir, key, value)
+}
+
+// insert inserts key at the position returned by search, and returns its node.
+func (t *RBTree) insert(p *node, dir direction, key adt.Key, value interface{}) *node {
 	// Find existing key.
 	if !p.isExternal() && dir == self {
 		p.Value = value
-		return
+		t.updatePath(p)
+		return p
 	}
 	t.length++
 	// Find root that is external
 	if p.isExternal() {
-		t.root = newInternalNode(key, value)
+		t.root = newInternalNode(key, value, t.sentinel)
 		t.root.color = colorBlack
-		return
+		t.update(t.root)
+		t.max = t.root
+		return t.root
 	}
 
-	n := newInternalNode(key, value)
+	n := newInternalNode(key, value, t.sentinel)
 	n.parent = p
 	p.setDir(dir, n)
+	if p == t.max && dir == right {
+		t.max = n
+	}
+	t.updatePath(n)
+	t.insertFixup(n)
+	t.root.color = colorBlack
+	return n
+}
+
+// insertFixup fixes the red node n whose parent may also be red, leaving the root possibly red.
+func (t *RBTree) insertFixup(n *node) {
 	for n != t.root && n.parent.isRed() {
 		uncle := n.parent.brother()
 		// case 1:
@@ -277,7 +319,6 @@ func (t *RBTree) Insert(key adt.Key, value interface{}) {
 			t.leftRotate(n.parent.parent)
 		}
 	}
-	t.root.color = colorBlack
 }
 
 // rechild sets n's parent's child to c, but not sets c'parent to n's parent.
@@ -311,21 +352,65 @@ func (t *RBTree) reparent(p, c *node) {
 func (t *RBTree) leftRotate(l *node) {
 	r := l.right
 	l.right = r.left
-	if r.left != nil {
+	if !r.left.isExternal() {
 		r.left.parent = l
 	}
 	t.reparent(l, r)
 	r.left = l
+	t.update(l)
+	t.update(r)
 }
 
 func (t *RBTree) rightRotate(r *node) {
 	l := r.left
 	r.left = l.right
-	if l.right != nil {
+	if !l.right.isExternal() {
 		l.right.parent = r
 	}
 	t.reparent(r, l)
 	l.right = r
+	t.update(r)
+	t.update(l)
+}
+
+// swap swaps the places and colors of the full node n and its successor s.
+func (t *RBTree) swap(n, s *node) {
+	sp, sr := s.parent, s.right
+	t.rechild(n, s)
+	s.parent = n.parent
+	s.left = n.left
+	s.left.parent = s
+	if s == n.right {
+		s.right = n
+		n.parent = s
+	} else {
+		s.right = n.right
+		s.right.parent = s
+		sp.left = n
+		n.parent = sp
+	}
+	n.left, n.right = t.sentinel, sr
+	if !sr.isExternal() {
+		sr.parent = n
+	}
+	n.color, s.color = s.color, n.color
+}
+
+// update recomputes the augmentation of n.
+func (t *RBTree) update(n *node) {
+	if t.augment != nil && !n.isExternal() {
+		t.augment(n)
+	}
+}
+
+// updatePath recomputes the augmentation from n up to the root.
+func (t *RBTree) updatePath(n *node) {
+	if t.augment == nil {
+		return
+	}
+	for ; n != nil; n = n.parent {
+		t.update(n)
+	}
 }
 
 func (t *RBTree) Delete(key adt.Key) interface{} {
@@ -342,15 +427,21 @@ func (t *RBTree) Delete(key adt.Key) interface{} {
 	return v
 }
 
+// delete removes the node n and invalidates it.
 func (t *RBTree) delete(n *node) {
+	if n == t.max {
+		t.max = n.prev()
+	}
 	if n.isFull() {
-		succ := n.successor()
-		n.Key, n.Value = succ.Key, succ.Value
-		n = succ
+		// Move the successor into the place of n rather than its entry, so that nodes keep their entries.
+		t.swap(n, n.successor())
 	}
 	child := n.child()
 	t.reparent(n, child)
-	if n.isRed() {
+	t.updatePath(child.parent)
+	red := n.isRed()
+	n.invalidate()
+	if red {
 		return
 	}
 	n = child
@@ -410,7 +501,21 @@ func (t *RBTree) String() string {
 }
 
 func (t *RBTree) Validate() bool {
-	return t.root.propertyRedHasNoRedChildren() && t.root.propertyBlackHeightEqual()
+	return t.root.propertyRedHasNoRedChildren() && t.root.propertyBlackHeightEqual() && t.validateSummary(t.root) &&
+		t.root.propertyParentLinked() && t.max == t.root.rightmost()
+}
+
+// propertyParentLinked checks parents of internal nodes, not of the sentinel.
+func (n *node) propertyParentLinked() bool {
+	if n.isExternal() {
+		return true
+	}
+	for _, c := range []*node{n.left, n.right} {
+		if !c.isExternal() && c.parent != n {
+			return false
+		}
+	}
+	return n.left.propertyParentLinked() && n.right.propertyParentLinked()
 }
 
 func (n *node) propertyRedHasNoRedChildren() bool {
@@ -450,3 +555,154 @@ func (n *node) blackHeight() (int, bool) {
 	}
 	return lbh, true
 }
+
+// DeleteRange removes all keys in [lo, hi), and returns the number of removed keys, and the removed entries if collect.
+// Instead of deleting keys one by one, it splits the tree at lo and hi, and joins the outer trees once,
+// which takes O(k + log n) for k removed keys.
+func (t *RBTree) DeleteRange(lo, hi adt.Key, collect bool) (int, []adt.Entry) {
+	if !lo.Less(hi) || t.root.isExternal() {
+		return 0, nil
+	}
+	l, lh, m, mh := t.split(t.root, t.root.spineBlackHeight(), lo)
+	m, _, r, rh := t.split(m, mh, hi)
+	var entries []adt.Entry
+	num := m.release(collect, &entries)
+	t.root = t.join2(l, lh, r, rh)
+	t.root.color = colorBlack
+	t.max = t.root.rightmost()
+	t.length -= num
+	return num, entries
+}
+
+// rightmost returns the node of the max key in the subtree, or nil.
+func (n *node) rightmost() *node {
+	if n.isExternal() {
+		return nil
+	}
+	for !n.right.isExternal() {
+		n = n.right
+	}
+	return n
+}
+
+// spineBlackHeight returns the black height of a valid tree by its left spine.
+func (n *node) spineBlackHeight() int {
+	h := 0
+	for ; !n.isExternal(); n = n.left {
+		if n.isBlack() {
+			h++
+		}
+	}
+	return h
+}
+
+// release invalidates the nodes of a removed subtree in order, and returns their number.
+func (n *node) release(collect bool, entries *[]adt.Entry) int {
+	if n.isExternal() {
+		return 0
+	}
+	num := n.left.release(collect, entries)
+	if collect {
+		*entries = append(*entries, adt.Entry{Key: n.Key, Value: n.Value})
+	}
+	right := n.right
+	n.invalidate()
+	return num + 1 + right.release(collect, entries)
+}
+
+// split splits the tree n of black height h into trees of keys less than key and the others,
+// and returns their roots and black heights.
+func (t *RBTree) split(n *node, h int, key adt.Key) (l *node, lh int, r *node, rh int) {
+	if n.isExternal() {
+		return n, 0, t.sentinel, 0
+	}
+	ch := h
+	if n.isBlack() {
+		ch--
+	}
+	left, right := n.left, n.right
+	left.parent, right.parent = nil, nil
+	if key.Less(n.Key) || key.Equal(n.Key) {
+		l, lh, r, rh = t.split(left, ch, key)
+		r, rh = t.join(r, rh, n, right, ch)
+		return l, lh, r, rh
+	}
+	l, lh, r, rh = t.split(right, ch, key)
+	l, lh = t.join(left, ch, n, l, lh)
+	return l, lh, r, rh
+}
+
+// join joins the trees l, r of black heights lh, rh and the node k, where keys of l < k.Key < keys of r.
+// It links k in the spine of the higher tree where the black heights meet, fixes it up like an insertion,
+// and returns the root and black height of the joined tree.
+func (t *RBTree) join(l *node, lh int, k *node, r *node, rh int) (*node, int) {
+	if l.isRed() {
+		l.color = colorBlack
+		lh++
+	}
+	if r.isRed() {
+		r.color = colorBlack
+		rh++
+	}
+	k.parent = nil
+	if lh == rh {
+		k.left, k.right, k.color = l, r, colorBlack
+		l.parent, r.parent = k, k
+		t.update(k)
+		return k, lh + 1
+	}
+	// Fix up in a tree of the higher one.
+	j := &RBTree{augment: t.augment, sentinel: t.sentinel}
+	h := lh
+	k.color = colorRed
+	if lh > rh {
+		j.root = l
+		p, c := l, l
+		for ch := lh; !c.isBlack() || ch != rh; p, c = c, c.right {
+			if c.isBlack() {
+				ch--
+			}
+		}
+		k.parent = p
+		p.right = k
+		k.left, k.right = c, r
+	} else {
+		j.root, h = r, rh
+		p, c := r, r
+		for ch := rh; !c.isBlack() || ch != lh; p, c = c, c.left {
+			if c.isBlack() {
+				ch--
+			}
+		}
+		k.parent = p
+		p.left = k
+		k.left, k.right = l, c
+	}
+	k.left.parent, k.right.parent = k, k
+	j.updatePath(k)
+	j.insertFixup(k)
+	if j.root.isRed() {
+		j.root.color = colorBlack
+		h++
+	}
+	return j.root, h
+}
+
+// join2 joins the trees l, r of black heights lh, rh, where keys of l < keys of r.
+func (t *RBTree) join2(l *node, lh int, r *node, rh int) *node {
+	if r.isExternal() {
+		return l
+	}
+	if l.isExternal() {
+		return r
+	}
+	// Delete the minimum of r and use it to join.
+	j := &RBTree{root: r, augment: t.augment, sentinel: t.sentinel}
+	min := r
+	for !min.left.isExternal() {
+		min = min.left
+	}
+	j.delete(min)
+	root, _ := t.join(l, lh, min, j.root, j.root.spineBlackHeight())
+	return root
+}
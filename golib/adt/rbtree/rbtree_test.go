@@ -1,6 +1,7 @@
 package rbtree_test
 
 import (
+	"runtime"
 	"testing"
 
 	"github.com/atriw/lib/golib/adt"
@@ -15,3 +16,23 @@ func TestRBTree(t *testing.T) {
 func BenchmarkRBTreeSearch(b *testing.B) {
 	adt.XBenchSearch(b, func() adt.ADT { return New() })
 }
+
+func TestRBTreeDeleteRange(t *testing.T) {
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return New() })
+}
+
+func BenchmarkRBTreeMemory(b *testing.B) {
+	const num = 10000
+	b.ReportAllocs()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < b.N; i++ {
+		rbt := New()
+		for k := 0; k < num; k++ {
+			rbt.Insert(key(k), nil)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N*num), "allocs/insert")
+	b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*num), "B/entry")
+}
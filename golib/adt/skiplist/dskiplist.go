@@ -0,0 +1,201 @@
+package skiplist
+
+import (
+	"github.com/atriw/lib/golib/adt"
+)
+
+// maxHeight bounds the height of DSkiplist, which holds at least 2^h-1 keys with height h.
+const maxHeight = 64
+
+// DSkiplist is the deterministic 1-2-3 skiplist by Munro, Papadakis and Sedgewick.
+// Between any two consecutive nodes higher than h (the header and the end count as infinitely high),
+// there are 1 to 3 nodes of height h. It is isomorphic to a 2-3-4 tree,
+// which bounds Insert, Search and Delete to O(log n) in the worst case.
+type DSkiplist struct {
+	length int
+	header *node
+	level  int
+}
+
+// NewDeterministic returns an empty DSkiplist
+func NewDeterministic() *DSkiplist {
+	return &DSkiplist{header: &node{key: &headerKey{}, forward: make([]*node, maxHeight)}}
+}
+
+func (sl *DSkiplist) prevNodes(key adt.Key) nodeList {
+	prev := make(nodeList, sl.level+1)
+	node := sl.header
+	for i := sl.level; i >= 0; i-- {
+		node = node.advance(i, key)
+		prev[i] = node
+	}
+	return prev
+}
+
+// boundary returns the node higher than i+1 that starts the gap of level i around prev.
+func (sl *DSkiplist) boundary(prev nodeList, i int) *node {
+	if i+1 < len(prev) {
+		return prev[i+1]
+	}
+	return sl.header
+}
+
+// gapSize returns the number of nodes of height i+1 between b and its next node of level i+1.
+func gapSize(b *node, i int) int {
+	size := 0
+	for n, end := b.forward[i], b.forward[i+1]; n != end; n = n.forward[i] {
+		size++
+	}
+	return size
+}
+
+// promote raises x from height i+1 to i+2, b being its previous node of level i+1.
+func promote(b, x *node, i int) {
+	x.forward = append(x.forward, b.forward[i+1])
+	b.forward[i+1] = x
+}
+
+// demote lowers x from height i+2 to i+1, b being its previous node of level i+1.
+func demote(b, x *node, i int) {
+	b.forward[i+1] = x.forward[i+1]
+	x.forward[i+1] = nil
+	x.forward = x.forward[:i+1]
+}
+
+// Search returns the value of key if exists, else nil
+func (sl *DSkiplist) Search(key adt.Key) interface{} {
+	prev := sl.prevNodes(key)
+	if prev.assertNext(key) {
+		return prev.next().value
+	}
+	return nil
+}
+
+// Insert inserts key, value into DSkiplist
+func (sl *DSkiplist) Insert(key adt.Key, value interface{}) {
+	prev := sl.prevNodes(key)
+	if prev.assertNext(key) {
+		prev.next().value = value
+		return
+	}
+	n := &node{key: key, value: value, forward: []*node{prev[0].forward[0]}}
+	prev[0].forward[0] = n
+	sl.length++
+	for i := 0; ; i++ {
+		b := sl.boundary(prev, i)
+		if gapSize(b, i) <= 3 {
+			return
+		}
+		// Split the gap of 4 into gaps of 1 and 2 by promoting the second node,
+		// which grows the gap of level i+1.
+		promote(b, b.forward[i].forward[i], i)
+		if i == sl.level {
+			sl.level++
+		}
+	}
+}
+
+// Delete removes and returns value of key
+func (sl *DSkiplist) Delete(key adt.Key) interface{} {
+	prev := sl.prevNodes(key)
+	if !prev.assertNext(key) {
+		return nil
+	}
+	n := prev.next()
+	v := n.value
+	if len(n.forward) > 1 {
+		// Like deleting an internal key of a B-tree, replace it with its successor,
+		// which is the first node of the gap of level 0 after it, and delete the successor instead.
+		succ := n.forward[0]
+		n.key, n.value = succ.key, succ.value
+		for i := range n.forward {
+			prev[i] = n
+		}
+	}
+	prev[0].forward[0] = prev.next().forward[0]
+	sl.length--
+	for i := 0; ; i++ {
+		b := sl.boundary(prev, i)
+		if gapSize(b, i) > 0 {
+			return v
+		}
+		if i == sl.level {
+			if sl.level > 0 {
+				sl.level--
+			}
+			return v
+		}
+		if !sl.fill(prev, b, i) {
+			return v
+		}
+	}
+}
+
+// fill fixes the empty gap of level i after b by borrowing from or merging with a sibling gap.
+// It reports whether they merged, which shrinks the gap of level i+1.
+func (sl *DSkiplist) fill(prev nodeList, b *node, i int) bool {
+	if e := b.forward[i+1]; e != nil && len(e.forward) == i+2 {
+		// The right sibling gap is after e.
+		if gapSize(e, i) >= 2 {
+			next := e.forward[i]
+			demote(b, e, i)
+			promote(b, next, i)
+			return false
+		}
+		demote(b, e, i)
+		return true
+	}
+	// Otherwise b is of height i+2 and the left sibling gap is before b.
+	a := sl.boundary(prev, i+1)
+	for a.forward[i+1] != b {
+		a = a.forward[i+1]
+	}
+	if gapSize(a, i) >= 2 {
+		last := a.forward[i]
+		for last.forward[i] != b {
+			last = last.forward[i]
+		}
+		demote(a, b, i)
+		promote(a, last, i)
+		return false
+	}
+	demote(a, b, i)
+	return true
+}
+
+// Length returns total number of elements
+func (sl *DSkiplist) Length() int {
+	return sl.length
+}
+
+// Validate checks the order of keys and the gap sizes of each level
+func (sl *DSkiplist) Validate() bool {
+	if sl.length == 0 {
+		return sl.level == 0 && sl.header.forward[0] == nil
+	}
+	length := 0
+	for n := sl.header.forward[0]; n != nil; n = n.forward[0] {
+		length++
+		if len(n.forward) > sl.level+1 {
+			return false
+		}
+		if next := n.forward[0]; next != nil && !n.key.Less(next.key) {
+			return false
+		}
+	}
+	if length != sl.length {
+		return false
+	}
+	for i := 0; i <= sl.level; i++ {
+		for b := sl.header; b != nil; b = b.forward[i+1] {
+			if size := gapSize(b, i); size < 1 || size > 3 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (sl *DSkiplist) String() string {
+	return printLevels(sl.header, sl.level, sl.length)
+}
@@ -0,0 +1,53 @@
+package skiplist_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/skiplist"
+)
+
+func TestDSkiplist(t *testing.T) {
+	sl := NewDeterministic()
+	adt.XTestADT(t, sl)
+}
+
+func TestDSkiplistRandom(t *testing.T) {
+	sl := NewDeterministic()
+	present := make(map[key]bool)
+	for i := 0; i < 5000; i++ {
+		k := key(rand.Intn(500))
+		if rand.Intn(3) == 0 {
+			v := sl.Delete(k)
+			if (v != nil) != present[k] {
+				t.Fatalf("Delete: key %v, expected present %v, actual %v", k, present[k], v)
+			}
+			delete(present, k)
+		} else {
+			sl.Insert(k, k)
+			present[k] = true
+		}
+		if !sl.Validate() {
+			t.Fatalf("Validate: gap invariant broken after %v operations\n%v", i+1, sl)
+		}
+	}
+	if sl.Length() != len(present) {
+		t.Errorf("Length: expected %v, actual %v", len(present), sl.Length())
+	}
+	for k := range present {
+		if sl.Search(k) != k {
+			t.Errorf("Search: expected %v, actual %v", k, sl.Search(k))
+		}
+	}
+	for k := range present {
+		sl.Delete(k)
+	}
+	if sl.Length() != 0 || !sl.Validate() {
+		t.Errorf("Delete: expected empty valid list, actual\n%v", sl)
+	}
+}
+
+func BenchmarkDSkiplistSearch(b *testing.B) {
+	adt.XBenchSearch(b, func() adt.ADT { return NewDeterministic() })
+}
@@ -12,6 +12,9 @@ type node struct {
 	key     adt.Key
 	value   interface{}
 	forward []*node
+	// span[i] is the number of level 0 links crossed by forward[i].
+	// If forward[i] is nil, it counts the nodes left behind n.
+	span []int
 }
 
 func (n *node) advance(level int, target adt.Key) *node {
@@ -44,6 +47,12 @@ type Skiplist struct {
 	maxLevel int
 	header   *node
 	level    int
+	// version is increased on every modification to detect stale hints.
+	version int
+	finger  bool
+	hint    *Hint
+	// p is the probability of each further level, 0 for uniform levels.
+	p float64
 }
 
 const defaultLevel = 5
@@ -58,15 +67,43 @@ func WithMaxLevel(l int) Option {
 	}
 }
 
+// WithFinger makes Skiplist remember the position of the last accessed key,
+// and start Insert, Search and Delete from there if the next key is after it.
+// Sorted or locally clustered accesses are then O(log d), d being the distance between consecutive keys.
+func WithFinger() Option {
+	return func(sl *Skiplist) {
+		sl.finger = true
+	}
+}
+
+// WithLevelProbability makes levels geometric, each further level with probability p, like p = 1/4 in Redis,
+// so that a search walks O(log n) links whatever the max level. By default levels are uniform in [0, max level).
+func WithLevelProbability(p float64) Option {
+	return func(sl *Skiplist) {
+		sl.p = p
+	}
+}
+
+// Hint is the position of an entry, returned by InsertAfter to speed up the next InsertAfter.
+// It is stale after any other modification of the Skiplist.
+type Hint struct {
+	// prev is the previous node tower of keys right after the entry.
+	prev    nodeList
+	rank    []int
+	version int
+}
+
 // New returns an empty Skiplist
 func New(opts ...Option) *Skiplist {
 	sl := &Skiplist{maxLevel: defaultLevel, header: &node{key: &headerKey{}}}
 	for _, o := range opts {
 		o(sl)
 	}
-	for i := 0; i < sl.maxLevel; i++ {
-		sl.header.forward = append(sl.header.forward, nil)
+	if sl.p < 0 || sl.p >= 1 {
+		panic("level probability should be in [0, 1)")
 	}
+	sl.header.forward = make([]*node, sl.maxLevel)
+	sl.header.span = make([]int, sl.maxLevel)
 
 	return sl
 }
@@ -81,8 +118,85 @@ func (sl *Skiplist) prevNodes(key adt.Key) nodeList {
 	return prev
 }
 
+// prevNodesRank is like prevNodes, but also returns the rank of each previous node,
+// where the header has rank 0 and the first node has rank 1.
+func (sl *Skiplist) prevNodesRank(key adt.Key) (nodeList, []int) {
+	prev := make(nodeList, sl.level+1)
+	rank := make([]int, sl.level+1)
+	node := sl.header
+	r := 0
+	for i := sl.level; i >= 0; i-- {
+		for next := node.forward[i]; next != nil && next.key.Less(key); next = node.forward[i] {
+			r += node.span[i]
+			node = next
+		}
+		prev[i] = node
+		rank[i] = r
+	}
+	return prev, rank
+}
+
+// find is like prevNodesRank, but climbs up from the previous nodes of hint if possible.
+// The previous nodes above the climbed level are the same as hint's.
+func (sl *Skiplist) find(key adt.Key, hint *Hint) (nodeList, []int) {
+	if hint == nil || hint.version != sl.version || !hint.prev[0].key.Less(key) {
+		return sl.prevNodesRank(key)
+	}
+	h := 0
+	for ; h < sl.level; h++ {
+		next := hint.prev[h].forward[h]
+		if next == nil || !next.key.Less(key) {
+			break
+		}
+	}
+	prev := make(nodeList, sl.level+1)
+	rank := make([]int, sl.level+1)
+	copy(prev[h+1:], hint.prev[h+1:])
+	copy(rank[h+1:], hint.rank[h+1:])
+	node := hint.prev[h]
+	r := hint.rank[h]
+	for i := h; i >= 0; i-- {
+		for next := node.forward[i]; next != nil && next.key.Less(key); next = node.forward[i] {
+			r += node.span[i]
+			node = next
+		}
+		prev[i] = node
+		rank[i] = r
+	}
+	return prev, rank
+}
+
+// newHint returns a hint from the previous nodes of key, stepping over key if exists.
+func (sl *Skiplist) newHint(prev nodeList, rank []int, key adt.Key) *Hint {
+	if prev.assertNext(key) {
+		n := prev.next()
+		r := rank[0] + 1
+		for i := range n.forward {
+			prev[i] = n
+			rank[i] = r
+		}
+	}
+	return &Hint{prev: prev, rank: rank, version: sl.version}
+}
+
+func (sl *Skiplist) fingerHint() *Hint {
+	if !sl.finger {
+		return nil
+	}
+	return sl.hint
+}
+
 // Search returns the value of key if exists, else nil
 func (sl *Skiplist) Search(key adt.Key) interface{} {
+	if sl.finger {
+		prev, rank := sl.find(key, sl.hint)
+		var v interface{}
+		if prev.assertNext(key) {
+			v = prev.next().value
+		}
+		sl.hint = sl.newHint(prev, rank, key)
+		return v
+	}
 	prev := sl.prevNodes(key)
 	if prev.assertNext(key) {
 		return prev.next().value
@@ -91,59 +205,325 @@ func (sl *Skiplist) Search(key adt.Key) interface{} {
 }
 
 func (sl *Skiplist) randLevel() int {
-	return rand.Intn(sl.maxLevel)
+	if sl.p == 0 {
+		return rand.Intn(sl.maxLevel)
+	}
+	level := 0
+	for level < sl.maxLevel-1 && rand.Float64() < sl.p {
+		level++
+	}
+	return level
 }
 
 // Insert inserts key, value into Skiplist
 func (sl *Skiplist) Insert(key adt.Key, value interface{}) {
-	prev := sl.prevNodes(key)
+	hint := sl.insert(sl.fingerHint(), key, value)
+	if sl.finger {
+		sl.hint = hint
+	}
+}
+
+// InsertAfter is like Insert, but searches from hint if key is after the hinted entry.
+// A nil or stale hint falls back to a full search.
+// It returns the hint of the inserted key.
+func (sl *Skiplist) InsertAfter(hint *Hint, key adt.Key, value interface{}) *Hint {
+	return sl.insert(hint, key, value)
+}
+
+func (sl *Skiplist) insert(hint *Hint, key adt.Key, value interface{}) *Hint {
+	prev, rank := sl.find(key, hint)
 	if prev.assertNext(key) {
 		prev.next().value = value
-		return
+		return sl.newHint(prev, rank, key)
 	}
 	newLevel := sl.randLevel()
 	if newLevel > sl.level {
 		sl.level++
 		newLevel = sl.level
 		prev = append(prev, sl.header)
+		rank = append(rank, 0)
+		sl.header.span[newLevel] = sl.length
+	}
+	sl.link(prev, rank, &node{key: key, value: value, forward: make([]*node, newLevel+1), span: make([]int, newLevel+1)})
+	return sl.newHint(prev, rank, key)
+}
+
+// link links n right after prev[0], rank[i] being the rank of prev[i].
+func (sl *Skiplist) link(prev nodeList, rank []int, n *node) {
+	for i := len(n.forward) - 1; i >= 0; i-- {
+		p := prev[i]
+		n.forward[i] = p.forward[i]
+		p.forward[i] = n
+		n.span[i] = p.span[i] - (rank[0] - rank[i])
+		p.span[i] = rank[0] - rank[i] + 1
 	}
-	newNode := &node{key: key, value: value, forward: make([]*node, newLevel+1)}
-	for i := newLevel; i >= 0; i-- {
-		node := prev[i]
-		newNode.forward[i] = node.forward[i]
-		node.forward[i] = newNode
+	for i := len(n.forward); i <= sl.level; i++ {
+		prev[i].span[i]++
 	}
 	sl.length++
+	sl.version++
 }
 
 // Remove removes and returns value of key
 func (sl *Skiplist) Delete(key adt.Key) interface{} {
+	if sl.finger {
+		prev, rank := sl.find(key, sl.hint)
+		var v interface{}
+		if prev.assertNext(key) {
+			node := prev.next()
+			sl.unlink(prev, node)
+			v = node.value
+		}
+		sl.hint = &Hint{prev: prev, rank: rank, version: sl.version}
+		return v
+	}
 	prev := sl.prevNodes(key)
 	if !prev.assertNext(key) {
 		return nil
 	}
-	sl.length--
 	node := prev.next()
-	for i, n := range node.forward {
-		prev[i].forward[i] = n
-	}
+	sl.unlink(prev, node)
 	return node.value
 }
 
+// DeleteRange removes all keys in [lo, hi) in one pass,
+// and returns the number of removed keys, and the removed entries if collect.
+func (sl *Skiplist) DeleteRange(lo, hi adt.Key, collect bool) (int, []adt.Entry) {
+	if !lo.Less(hi) {
+		return 0, nil
+	}
+	prev, rank := sl.find(lo, sl.fingerHint())
+	var entries []adt.Entry
+	num := 0
+	for n := prev.next(); n != nil && n.key.Less(hi); n = n.forward[0] {
+		if collect {
+			entries = append(entries, adt.Entry{Key: n.key, Value: n.value})
+		}
+		num++
+	}
+	if num == 0 {
+		return 0, nil
+	}
+	for i := 0; i <= sl.level; i++ {
+		// The removed nodes are all between prev[i] and the next node of level i not less than hi.
+		p := prev[i]
+		span := p.span[i]
+		for n := p.forward[i]; n != nil && n.key.Less(hi); n = n.forward[i] {
+			span += n.span[i]
+			p.forward[i] = n.forward[i]
+		}
+		p.span[i] = span - num
+	}
+	sl.length -= num
+	sl.version++
+	if sl.finger {
+		sl.hint = &Hint{prev: prev, rank: rank, version: sl.version}
+	}
+	return num, entries
+}
+
+// DeleteRangeByRank removes the entries of 0-based ranks in [start, end) in one pass,
+// and returns the number of removed entries, and the removed entries if collect.
+func (sl *Skiplist) DeleteRangeByRank(start, end int, collect bool) (int, []adt.Entry) {
+	if start < 0 {
+		start = 0
+	}
+	if end > sl.length {
+		end = sl.length
+	}
+	if start >= end {
+		return 0, nil
+	}
+	prev, rank := sl.prevNodesByRank(start)
+	var entries []adt.Entry
+	num := end - start
+	if collect {
+		n := prev.next()
+		for i := 0; i < num; i++ {
+			entries = append(entries, adt.Entry{Key: n.key, Value: n.value})
+			n = n.forward[0]
+		}
+	}
+	for i := 0; i <= sl.level; i++ {
+		// span is the distance from prev[i] to p.forward[i], whose 1-based rank is rank[i]+span.
+		p := prev[i]
+		span := p.span[i]
+		for n := p.forward[i]; n != nil && rank[i]+span <= end; n = p.forward[i] {
+			span += n.span[i]
+			p.forward[i] = n.forward[i]
+		}
+		p.span[i] = span - num
+	}
+	sl.length -= num
+	sl.version++
+	if sl.finger {
+		sl.hint = &Hint{prev: prev, rank: rank, version: sl.version}
+	}
+	return num, entries
+}
+
+// prevNodesByRank is like prevNodesRank, but returns the previous nodes of the entry of 1-based rank+1.
+func (sl *Skiplist) prevNodesByRank(rank int) (nodeList, []int) {
+	prev := make(nodeList, sl.level+1)
+	ranks := make([]int, sl.level+1)
+	node := sl.header
+	r := 0
+	for i := sl.level; i >= 0; i-- {
+		for next := node.forward[i]; next != nil && r+node.span[i] <= rank; next = node.forward[i] {
+			r += node.span[i]
+			node = next
+		}
+		prev[i] = node
+		ranks[i] = r
+	}
+	return prev, ranks
+}
+
+// unlink unlinks n, which must be right after prev[0].
+func (sl *Skiplist) unlink(prev nodeList, n *node) {
+	for i := 0; i <= sl.level; i++ {
+		if i < len(n.forward) {
+			prev[i].span[i] += n.span[i] - 1
+			prev[i].forward[i] = n.forward[i]
+		} else {
+			prev[i].span[i]--
+		}
+	}
+	sl.length--
+	sl.version++
+}
+
 // Length returns total number of elements
 func (sl *Skiplist) Length() int {
 	return sl.length
 }
 
+// Rank returns the 0-based rank of key if exists, else -1
+func (sl *Skiplist) Rank(key adt.Key) int {
+	node := sl.header
+	r := 0
+	for i := sl.level; i >= 0; i-- {
+		for next := node.forward[i]; next != nil && !key.Less(next.key); next = node.forward[i] {
+			r += node.span[i]
+			node = next
+		}
+		if node != sl.header && node.key.Equal(key) {
+			return r - 1
+		}
+	}
+	return -1
+}
+
+// byRank returns the node of the given 1-based rank, or the header if rank is 0.
+func (sl *Skiplist) byRank(rank int) *node {
+	node := sl.header
+	r := 0
+	for i := sl.level; i >= 0; i-- {
+		for next := node.forward[i]; next != nil && r+node.span[i] <= rank; next = node.forward[i] {
+			r += node.span[i]
+			node = next
+		}
+		if r == rank {
+			break
+		}
+	}
+	return node
+}
+
+// ByRank returns the key and value of the given 0-based rank, or nil if out of range
+func (sl *Skiplist) ByRank(rank int) (adt.Key, interface{}) {
+	if rank < 0 || rank >= sl.length {
+		return nil, nil
+	}
+	n := sl.byRank(rank + 1)
+	return n.key, n.value
+}
+
+// Iterator iterates over the entries of Skiplist in key order.
+// It is invalidated by any modification of the Skiplist.
+type Iterator struct {
+	node *node
+}
+
+// Valid reports whether the iterator is positioned at an entry
+func (it *Iterator) Valid() bool {
+	return it.node != nil
+}
+
+// Key returns the key of the current entry
+func (it *Iterator) Key() adt.Key {
+	return it.node.key
+}
+
+// Value returns the value of the current entry
+func (it *Iterator) Value() interface{} {
+	return it.node.value
+}
+
+// Next moves to the next entry
+func (it *Iterator) Next() {
+	it.node = it.node.forward[0]
+}
+
+// First returns an iterator positioned at the smallest entry
+func (sl *Skiplist) First() *Iterator {
+	return &Iterator{node: sl.header.forward[0]}
+}
+
+// Seek returns an iterator positioned at the first entry whose key is not less than key
+func (sl *Skiplist) Seek(key adt.Key) *Iterator {
+	return &Iterator{node: sl.prevNodes(key).next()}
+}
+
+// SeekRank returns an iterator positioned at the entry of the given 0-based rank
+func (sl *Skiplist) SeekRank(rank int) *Iterator {
+	if rank < 0 || rank >= sl.length {
+		return &Iterator{}
+	}
+	return &Iterator{node: sl.byRank(rank + 1)}
+}
+
+// Validate checks the order of keys and the span of each link
+func (sl *Skiplist) Validate() bool {
+	rank := map[*node]int{sl.header: 0}
+	r := 0
+	for n := sl.header.forward[0]; n != nil; n = n.forward[0] {
+		r++
+		rank[n] = r
+		if next := n.forward[0]; next != nil && !n.key.Less(next.key) {
+			return false
+		}
+	}
+	if r != sl.length {
+		return false
+	}
+	for i := 0; i <= sl.level; i++ {
+		for n := sl.header; n != nil; n = n.forward[i] {
+			to := sl.length
+			if n.forward[i] != nil {
+				to = rank[n.forward[i]]
+			}
+			if n.span[i] != to-rank[n] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (sl *Skiplist) String() string {
+	return printLevels(sl.header, sl.level, sl.length)
+}
+
+func printLevels(header *node, level, length int) string {
 	var sb strings.Builder
 	zeroIndex := make(map[*node]int)
 	indexLength := make(map[int]int)
 	var buf []string
-	for i := 0; i <= sl.level; i++ {
+	for i := 0; i <= level; i++ {
 		sb.WriteString(fmt.Sprintf("%v: header->", i))
 		j := 0
-		for node := sl.header.forward[i]; node != nil; node = node.forward[i] {
+		for node := header.forward[i]; node != nil; node = node.forward[i] {
 			s := fmt.Sprintf("[%v:%v]", node.key, node.value)
 			if i == 0 {
 				zeroIndex[node] = j
@@ -157,7 +537,7 @@ func (sl *Skiplist) String() string {
 			sb.WriteString("--")
 			j++
 		}
-		for ; j < sl.length; j++ {
+		for ; j < length; j++ {
 			sb.WriteString(strings.Repeat("-", indexLength[j]+2))
 		}
 		sb.WriteString("<nil>")
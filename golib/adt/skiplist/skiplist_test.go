@@ -1,6 +1,8 @@
 package skiplist_test
 
 import (
+	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/atriw/lib/golib/adt"
@@ -12,6 +14,197 @@ func TestSkiplist(t *testing.T) {
 	adt.XTestADT(t, sl)
 }
 
+func TestSkiplistLevelProbability(t *testing.T) {
+	adt.XTestADT(t, New(WithMaxLevel(32), WithLevelProbability(0.25)))
+}
+
 func BenchmarkSkiplistSearch(b *testing.B) {
 	adt.XBenchSearch(b, func() adt.ADT { return New(WithMaxLevel(15)) })
 }
+
+type key int
+
+func (k key) Less(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k < i
+}
+
+func (k key) Equal(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k == i
+}
+
+func TestSkiplistRank(t *testing.T) {
+	sl := New(WithMaxLevel(8))
+	for i := 0; i < 200; i++ {
+		sl.Insert(key((i*37)%200), i)
+	}
+	for i := 0; i < 200; i += 3 {
+		sl.Delete(key(i))
+	}
+	if !sl.Validate() {
+		t.Fatalf("Validate: spans broken\n%v", sl)
+	}
+	r := 0
+	for it := sl.First(); it.Valid(); it.Next() {
+		if rank := sl.Rank(it.Key()); rank != r {
+			t.Errorf("Rank: key %v, expected %v, actual %v", it.Key(), r, rank)
+		}
+		if k, _ := sl.ByRank(r); !it.Key().Equal(k) {
+			t.Errorf("ByRank: rank %v, expected %v, actual %v", r, it.Key(), k)
+		}
+		r++
+	}
+	if r != sl.Length() {
+		t.Errorf("Iterator: expected %v entries, actual %v", sl.Length(), r)
+	}
+	if rank := sl.Rank(key(3)); rank != -1 {
+		t.Errorf("Rank: deleted key, expected -1, actual %v", rank)
+	}
+	if it := sl.Seek(key(3)); !it.Valid() || !it.Key().Equal(key(4)) {
+		t.Errorf("Seek: expected 4")
+	}
+	if it := sl.SeekRank(sl.Length()); it.Valid() {
+		t.Errorf("SeekRank: expected invalid iterator out of range")
+	}
+}
+
+func TestSkiplistFinger(t *testing.T) {
+	adt.XTestADT(t, New(WithFinger()))
+	sl := New(WithFinger())
+	for i := 100; i < 300; i++ {
+		sl.Insert(key(i), i)
+	}
+	for i := 299; i >= 100; i -= 7 {
+		sl.Insert(key(i), -i)
+	}
+	for i := 100; i < 300; i += 2 {
+		sl.Delete(key(i))
+	}
+	if !sl.Validate() {
+		t.Fatalf("Validate: spans broken\n%v", sl)
+	}
+	for i := 100; i < 300; i++ {
+		v := sl.Search(key(i))
+		if i%2 == 0 && v != nil {
+			t.Errorf("Search: expected nil, actual %v", v)
+		}
+		if i%2 == 1 && v == nil {
+			t.Errorf("Search: expected %v, actual nil", i)
+		}
+	}
+}
+
+func TestSkiplistInsertAfter(t *testing.T) {
+	sl := New(WithMaxLevel(10))
+	var hint *Hint
+	for i := 0; i < 100; i += 2 {
+		hint = sl.InsertAfter(hint, key(i), i)
+	}
+	// Stale hint and hint after the key both fall back to full search.
+	sl.Delete(key(50))
+	for i := 99; i >= 1; i -= 2 {
+		hint = sl.InsertAfter(hint, key(i), i)
+	}
+	if !sl.Validate() {
+		t.Fatalf("Validate: spans broken\n%v", sl)
+	}
+	if sl.Length() != 99 {
+		t.Errorf("Length: expected 99, actual %v", sl.Length())
+	}
+	for i := 0; i < 100; i++ {
+		if v := sl.Search(key(i)); i != 50 && v != i {
+			t.Errorf("Search: expected %v, actual %v", i, v)
+		}
+	}
+}
+
+func BenchmarkSkiplistSequentialInsert(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "header", opts: []Option{WithMaxLevel(15)}},
+		{name: "finger", opts: []Option{WithMaxLevel(15), WithFinger()}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			sl := New(bb.opts...)
+			for i := 0; i < b.N; i++ {
+				sl.Insert(key(i), nil)
+			}
+		})
+	}
+}
+
+func TestSkiplistDeleteRange(t *testing.T) {
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return New(WithMaxLevel(10)) })
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return New(WithMaxLevel(10), WithFinger()) })
+	sl := New(WithMaxLevel(10))
+	for i := 0; i < 100; i++ {
+		sl.Insert(key(i), i)
+	}
+	sl.DeleteRange(key(10), key(90), false)
+	if !sl.Validate() {
+		t.Errorf("Validate: spans broken\n%v", sl)
+	}
+}
+
+func TestSkiplistDeleteRangeByRank(t *testing.T) {
+	for _, opts := range [][]Option{{WithMaxLevel(10)}, {WithMaxLevel(10), WithFinger()}} {
+		sl := New(opts...)
+		var model []int
+		for i := 0; i < 300; i++ {
+			sl.Insert(key(i), i)
+			model = append(model, i)
+		}
+		for _, r := range [][2]int{{10, 20}, {0, 5}, {250, 400}, {30, 30}, {-3, 1}, {40, 120}} {
+			start, end := r[0], r[1]
+			num, entries := sl.DeleteRangeByRank(start, end, true)
+			if start < 0 {
+				start = 0
+			}
+			if end > len(model) {
+				end = len(model)
+			}
+			if end < start {
+				end = start
+			}
+			if num != end-start || len(entries) != num {
+				t.Fatalf("DeleteRangeByRank: [%v, %v), expected %v removed, actual %v", r[0], r[1], end-start, num)
+			}
+			for i, e := range entries {
+				if e.Value != model[start+i] {
+					t.Errorf("DeleteRangeByRank: expected %v, actual %v", model[start+i], e.Value)
+				}
+			}
+			model = append(model[:start], model[end:]...)
+			if !sl.Validate() {
+				t.Fatalf("Validate: spans broken\n%v", sl)
+			}
+		}
+		for i, v := range model {
+			if k, _ := sl.ByRank(i); k != key(v) {
+				t.Errorf("ByRank: rank %v, expected %v, actual %v", i, v, k)
+			}
+		}
+	}
+}
+
+// BenchmarkSkiplistRank shows that Rank grows linearly with the number of keys with uniform levels,
+// and logarithmically with geometric levels.
+func BenchmarkSkiplistRank(b *testing.B) {
+	for _, p := range []float64{0, 0.25} {
+		for _, n := range []int{1000, 10000, 100000} {
+			b.Run(fmt.Sprintf("p=%v/%v", p, n), func(b *testing.B) {
+				sl := New(WithMaxLevel(32), WithLevelProbability(p))
+				for _, i := range rand.Perm(n) {
+					sl.Insert(key(i), nil)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					sl.Rank(key(rand.Intn(n)))
+				}
+			})
+		}
+	}
+}
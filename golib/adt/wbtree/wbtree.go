@@ -0,0 +1,414 @@
+package wbtree
+
+import (
+	"fmt"
+
+	"github.com/atriw/lib/golib/adt"
+)
+
+// The balance parameters of Haskell's Data.Map.
+// A node is balanced if neither subtree is more than delta times as large as the other,
+// and a single rotation is used if the inner grandchild is less than ratio times as large as the outer one.
+const (
+	delta = 3
+	ratio = 2
+)
+
+type node struct {
+	Key   adt.Key
+	Value interface{}
+
+	left  *node
+	right *node
+	n     int
+}
+
+func (n *node) size() int {
+	if n == nil {
+		return 0
+	}
+	return n.n
+}
+
+func (n *node) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("[%v:%v:%v]", n.Key, n.Value, n.n)
+}
+
+func (n *node) Left() adt.TreeNode {
+	return n.left
+}
+
+func (n *node) Right() adt.TreeNode {
+	return n.right
+}
+
+func (n *node) External() bool {
+	return n == nil
+}
+
+// WBTree is a weight-balanced tree, also known as BB[α] tree, balanced by the sizes of subtrees.
+// The sizes make Split, Join and the set operations simple.
+type WBTree struct {
+	root *node
+}
+
+func New() *WBTree {
+	return &WBTree{}
+}
+
+func (t *WBTree) Search(key adt.Key) interface{} {
+	n := t.root
+	for n != nil {
+		if key.Equal(n.Key) {
+			return n.Value
+		}
+		if key.Less(n.Key) {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return nil
+}
+
+func (t *WBTree) Insert(key adt.Key, value interface{}) {
+	t.root = insert(t.root, key, value)
+}
+
+func insert(n *node, key adt.Key, value interface{}) *node {
+	if n == nil {
+		return &node{Key: key, Value: value, n: 1}
+	}
+	if key.Equal(n.Key) {
+		n.Value = value
+		return n
+	}
+	if key.Less(n.Key) {
+		n.left = insert(n.left, key, value)
+	} else {
+		n.right = insert(n.right, key, value)
+	}
+	return balance(n)
+}
+
+func (t *WBTree) Delete(key adt.Key) interface{} {
+	var deleted *node
+	t.root = remove(t.root, key, &deleted)
+	if deleted == nil {
+		return nil
+	}
+	return deleted.Value
+}
+
+func remove(n *node, key adt.Key, deleted **node) *node {
+	if n == nil {
+		return nil
+	}
+	if key.Equal(n.Key) {
+		*deleted = n
+		return glue(n.left, n.right)
+	}
+	if key.Less(n.Key) {
+		n.left = remove(n.left, key, deleted)
+	} else {
+		n.right = remove(n.right, key, deleted)
+	}
+	return balance(n)
+}
+
+func update(n *node) {
+	n.n = n.left.size() + n.right.size() + 1
+}
+
+// balance restores the balance of n after one of its subtrees changed by at most one entry, or was linked by link or merge.
+func balance(n *node) *node {
+	l, r := n.left.size(), n.right.size()
+	if l+r <= 1 {
+		update(n)
+		return n
+	}
+	if r > delta*l {
+		if n.right.left.size() >= ratio*n.right.right.size() {
+			n.right = rightRotate(n.right)
+		}
+		return leftRotate(n)
+	}
+	if l > delta*r {
+		if n.left.right.size() >= ratio*n.left.left.size() {
+			n.left = leftRotate(n.left)
+		}
+		return rightRotate(n)
+	}
+	update(n)
+	return n
+}
+
+func leftRotate(n *node) *node {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	update(n)
+	update(r)
+	return r
+}
+
+func rightRotate(n *node) *node {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	update(n)
+	update(l)
+	return l
+}
+
+// glue joins the children l, r of a removed node, which are balanced with each other,
+// by moving up the boundary entry of the larger one.
+func glue(l, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	var m *node
+	if l.size() > r.size() {
+		l, m = deleteMax(l)
+	} else {
+		r, m = deleteMin(r)
+	}
+	m.left, m.right = l, r
+	return balance(m)
+}
+
+func deleteMin(n *node) (*node, *node) {
+	if n.left == nil {
+		return n.right, n
+	}
+	var min *node
+	n.left, min = deleteMin(n.left)
+	return balance(n), min
+}
+
+func deleteMax(n *node) (*node, *node) {
+	if n.right == nil {
+		return n.left, n
+	}
+	var max *node
+	n.right, max = deleteMax(n.right)
+	return balance(n), max
+}
+
+// link joins the trees l, r and the node k, where keys of l < k.Key < keys of r.
+// It descends the spine of the larger tree until the sizes are balanced and links k there.
+func link(k, l, r *node) *node {
+	if delta*l.size() < r.size() {
+		r.left = link(k, l, r.left)
+		return balance(r)
+	}
+	if delta*r.size() < l.size() {
+		l.right = link(k, l.right, r)
+		return balance(l)
+	}
+	k.left, k.right = l, r
+	update(k)
+	return k
+}
+
+// merge joins the trees l, r, where keys of l < keys of r.
+func merge(l, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	if delta*l.size() < r.size() {
+		r.left = merge(l, r.left)
+		return balance(r)
+	}
+	if delta*r.size() < l.size() {
+		l.right = merge(l.right, r)
+		return balance(l)
+	}
+	return glue(l, r)
+}
+
+// split splits n into trees of keys less than key and greater than key, and returns the node of key if found.
+func split(n *node, key adt.Key) (l, found, r *node) {
+	if n == nil {
+		return nil, nil, nil
+	}
+	if key.Equal(n.Key) {
+		l, r = n.left, n.right
+		n.left, n.right, n.n = nil, nil, 1
+		return l, n, r
+	}
+	if key.Less(n.Key) {
+		l, found, r = split(n.left, key)
+		return l, found, link(n, r, n.right)
+	}
+	l, found, r = split(n.right, key)
+	return link(n, n.left, l), found, r
+}
+
+// Split moves the keys not less than key to a new tree and returns it, t keeps the keys less than key.
+func (t *WBTree) Split(key adt.Key) *WBTree {
+	l, found, r := split(t.root, key)
+	if found != nil {
+		r = link(found, nil, r)
+	}
+	t.root = l
+	return &WBTree{root: r}
+}
+
+// Join moves all entries of other to t and leaves other empty.
+// It panics unless all keys of other are greater than keys of t.
+func (t *WBTree) Join(other *WBTree) {
+	if t.root != nil && other.root != nil && !t.root.max().Key.Less(other.root.min().Key) {
+		panic("join: keys are not ordered")
+	}
+	t.root = merge(t.root, other.root)
+	other.root = nil
+}
+
+func (n *node) min() *node {
+	for n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+func (n *node) max() *node {
+	for n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+// Union adds the entries of other whose keys are not in t to t, keeping the values of t for common keys.
+// It moves the nodes of other and leaves it empty.
+// Like the set operations below it takes O(m log(n/m + 1)) for the sizes m <= n of the trees.
+func (t *WBTree) Union(other *WBTree) {
+	t.root = union(t.root, other.root)
+	other.root = nil
+}
+
+func union(a, b *node) *node {
+	if b == nil {
+		return a
+	}
+	if a == nil {
+		return b
+	}
+	l, _, r := split(b, a.Key)
+	al, ar := a.left, a.right
+	return link(a, union(al, l), union(ar, r))
+}
+
+// Intersection removes the entries whose keys are not in other from t.
+// It splits the nodes of other and leaves it empty.
+func (t *WBTree) Intersection(other *WBTree) {
+	t.root = intersection(t.root, other.root)
+	other.root = nil
+}
+
+func intersection(a, b *node) *node {
+	if a == nil || b == nil {
+		return nil
+	}
+	l, found, r := split(b, a.Key)
+	al, ar := a.left, a.right
+	l, r = intersection(al, l), intersection(ar, r)
+	if found == nil {
+		return merge(l, r)
+	}
+	return link(a, l, r)
+}
+
+// Difference removes the entries whose keys are in other from t, and leaves other unchanged.
+func (t *WBTree) Difference(other *WBTree) {
+	t.root = difference(t.root, other.root)
+}
+
+func difference(a, b *node) *node {
+	if a == nil || b == nil {
+		return a
+	}
+	l, _, r := split(a, b.Key)
+	return merge(difference(l, b.left), difference(r, b.right))
+}
+
+// DeleteRange removes all keys in [lo, hi), and returns the number of removed keys, and the removed entries if collect.
+// It splits the tree at lo and hi, and merges the outer trees.
+func (t *WBTree) DeleteRange(lo, hi adt.Key, collect bool) (int, []adt.Entry) {
+	if !lo.Less(hi) || t.root == nil {
+		return 0, nil
+	}
+	l, found, m := split(t.root, lo)
+	if found != nil {
+		m = link(found, nil, m)
+	}
+	m, found, r := split(m, hi)
+	if found != nil {
+		r = link(found, nil, r)
+	}
+	var entries []adt.Entry
+	if collect {
+		m.inorder(&entries)
+	}
+	t.root = merge(l, r)
+	return m.size(), entries
+}
+
+func (n *node) inorder(entries *[]adt.Entry) {
+	if n == nil {
+		return
+	}
+	n.left.inorder(entries)
+	*entries = append(*entries, adt.Entry{Key: n.Key, Value: n.Value})
+	n.right.inorder(entries)
+}
+
+func (t *WBTree) Length() int {
+	return t.root.size()
+}
+
+func (t *WBTree) String() string {
+	return adt.PrintTree(t.root)
+}
+
+func (t *WBTree) Validate() bool {
+	return t.root.propertySizeCorrect() && t.root.propertyWeightBalanced() && t.root.propertyOrdered(nil, nil)
+}
+
+func (n *node) propertySizeCorrect() bool {
+	if n == nil {
+		return true
+	}
+	return n.n == n.left.size()+n.right.size()+1 && n.left.propertySizeCorrect() && n.right.propertySizeCorrect()
+}
+
+func (n *node) propertyWeightBalanced() bool {
+	if n == nil {
+		return true
+	}
+	l, r := n.left.size(), n.right.size()
+	if l+r > 1 && (l > delta*r || r > delta*l) {
+		return false
+	}
+	return n.left.propertyWeightBalanced() && n.right.propertyWeightBalanced()
+}
+
+// propertyOrdered checks that keys of n are in (lo, hi), a nil bound means unbounded.
+func (n *node) propertyOrdered(lo, hi adt.Key) bool {
+	if n == nil {
+		return true
+	}
+	if lo != nil && !lo.Less(n.Key) || hi != nil && !n.Key.Less(hi) {
+		return false
+	}
+	return n.left.propertyOrdered(lo, n.Key) && n.right.propertyOrdered(n.Key, hi)
+}
@@ -0,0 +1,157 @@
+package wbtree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/atriw/lib/golib/adt"
+	. "github.com/atriw/lib/golib/adt/wbtree"
+)
+
+type key int
+
+func (k key) Less(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k < i
+}
+
+func (k key) Equal(other interface{}) bool {
+	i, ok := other.(key)
+	return ok && k == i
+}
+
+func TestWBTree(t *testing.T) {
+	wbt := New()
+	adt.XTestADT(t, wbt)
+}
+
+func TestWBTreeDeleteRange(t *testing.T) {
+	adt.XTestDeleteRange(t, func() adt.RangeDeleter { return New() })
+}
+
+func BenchmarkWBTreeSearch(b *testing.B) {
+	adt.XBenchSearch(b, func() adt.ADT { return New() })
+}
+
+func BenchmarkWBTreeInsert(b *testing.B) {
+	adt.XBenchInsert(b, func() adt.ADT { return New() })
+}
+
+func BenchmarkWBTreeDelete(b *testing.B) {
+	adt.XBenchDelete(b, func() adt.ADT { return New() })
+}
+
+func randTree(n, max int, value int) (*WBTree, map[key]int) {
+	t := New()
+	m := make(map[key]int)
+	for i := 0; i < n; i++ {
+		k := key(rand.Intn(max))
+		t.Insert(k, value)
+		m[k] = value
+	}
+	return t, m
+}
+
+func checkTree(t *testing.T, op string, tree *WBTree, expected map[key]int) {
+	if !tree.Validate() {
+		t.Fatalf("%v: invalid tree\n%v", op, tree)
+	}
+	if tree.Length() != len(expected) {
+		t.Fatalf("%v: expected len %v, actual len %v", op, len(expected), tree.Length())
+	}
+	for k, v := range expected {
+		if actual := tree.Search(k); actual != v {
+			t.Fatalf("%v: key %v, expected %v, actual %v", op, k, v, actual)
+		}
+	}
+}
+
+func TestWBTreeSplitJoin(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		tree, m := randTree(rand.Intn(500), 1000, 1)
+		k := key(rand.Intn(1000))
+		r := tree.Split(k)
+		lm, rm := make(map[key]int), make(map[key]int)
+		for x, v := range m {
+			if x < k {
+				lm[x] = v
+			} else {
+				rm[x] = v
+			}
+		}
+		checkTree(t, "Split", tree, lm)
+		checkTree(t, "Split", r, rm)
+		tree.Join(r)
+		checkTree(t, "Join", tree, m)
+		if r.Length() != 0 {
+			t.Fatalf("Join: expected other empty, actual len %v", r.Length())
+		}
+	}
+}
+
+func TestWBTreeJoinUnordered(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Join: expected panic on unordered keys")
+		}
+	}()
+	a, b := New(), New()
+	a.Insert(key(2), 2)
+	b.Insert(key(1), 1)
+	a.Join(b)
+}
+
+func TestWBTreeSetOperations(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		// Sizes of different magnitudes to exercise the unbalanced links.
+		n, m := rand.Intn(1000), rand.Intn(50)
+		if i%2 == 0 {
+			n, m = m, n
+		}
+
+		a, am := randTree(n, 1000, 1)
+		b, bm := randTree(m, 1000, 2)
+		expected := make(map[key]int)
+		for k, v := range bm {
+			expected[k] = v
+		}
+		for k, v := range am {
+			expected[k] = v
+		}
+		a.Union(b)
+		checkTree(t, "Union", a, expected)
+
+		a, am = randTree(n, 1000, 1)
+		b, bm = randTree(m, 1000, 2)
+		expected = make(map[key]int)
+		for k, v := range am {
+			if _, ok := bm[k]; ok {
+				expected[k] = v
+			}
+		}
+		a.Intersection(b)
+		checkTree(t, "Intersection", a, expected)
+
+		a, am = randTree(n, 1000, 1)
+		b, bm = randTree(m, 1000, 2)
+		expected = make(map[key]int)
+		for k, v := range am {
+			if _, ok := bm[k]; !ok {
+				expected[k] = v
+			}
+		}
+		a.Difference(b)
+		checkTree(t, "Difference", a, expected)
+		checkTree(t, "Difference", b, bm)
+	}
+}
+
+func BenchmarkWBTreeUnion(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		x, _ := randTree(10000, 100000, 1)
+		y, _ := randTree(1000, 100000, 2)
+		b.StartTimer()
+		x.Union(y)
+	}
+}
@@ -0,0 +1,282 @@
+package zset
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/atriw/lib/golib/adt/skiplist"
+)
+
+var (
+	// ErrIncompatibleFlags is returned when NX is combined with XX, GT or LT, or GT is combined with LT
+	ErrIncompatibleFlags = errors.New("zset: incompatible flags")
+	// ErrNaN is returned when a score is or would become NaN
+	ErrNaN = errors.New("zset: score is not a number")
+)
+
+// element is the key of the underlying skiplist, ordered by (score, member).
+type element struct {
+	score  float64
+	member string
+}
+
+func (e element) Less(other interface{}) bool {
+	switch o := other.(type) {
+	case element:
+		return e.score < o.score || (e.score == o.score && e.member < o.member)
+	case lexKey:
+		return e.member < string(o)
+	}
+	return false
+}
+
+func (e element) Equal(other interface{}) bool {
+	o, ok := other.(element)
+	return ok && e == o
+}
+
+func (e element) String() string {
+	return fmt.Sprintf("%v:%v", e.member, e.score)
+}
+
+// lexKey seeks by member only, which is meaningful when all elements share one score.
+type lexKey string
+
+func (k lexKey) Less(other interface{}) bool {
+	e, ok := other.(element)
+	return ok && string(k) < e.member
+}
+
+func (k lexKey) Equal(other interface{}) bool {
+	e, ok := other.(element)
+	return ok && string(k) == e.member
+}
+
+// Element is a member with its score
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// Flag modifies the behavior of Add
+type Flag int
+
+const (
+	// NX only adds new elements, never updates existing ones
+	NX Flag = 1 << iota
+	// XX only updates existing elements, never adds new ones
+	XX
+	// GT only updates existing elements if the new score is greater
+	GT
+	// LT only updates existing elements if the new score is less
+	LT
+)
+
+// ZSet is a Redis style sorted set: members with float scores, ordered by (score, member).
+// Like Skiplist, it is not safe for concurrent use.
+type ZSet struct {
+	sl   *skiplist.Skiplist
+	dict map[string]float64
+}
+
+const maxLevel = 15
+
+// New returns an empty ZSet
+func New() *ZSet {
+	return &ZSet{sl: skiplist.New(skiplist.WithMaxLevel(maxLevel), skiplist.WithLevelProbability(0.25)), dict: make(map[string]float64)}
+}
+
+// Len returns the number of members (ZCARD)
+func (z *ZSet) Len() int {
+	return len(z.dict)
+}
+
+// Add sets the score of member (ZADD) and reports whether a new member was added
+func (z *ZSet) Add(score float64, member string, flags Flag) (bool, error) {
+	if math.IsNaN(score) {
+		return false, ErrNaN
+	}
+	if flags&NX != 0 && flags&(XX|GT|LT) != 0 || flags&GT != 0 && flags&LT != 0 {
+		return false, ErrIncompatibleFlags
+	}
+	old, ok := z.dict[member]
+	if !ok {
+		if flags&XX != 0 {
+			return false, nil
+		}
+		z.dict[member] = score
+		z.sl.Insert(element{score: score, member: member}, nil)
+		return true, nil
+	}
+	if flags&NX != 0 || flags&GT != 0 && score <= old || flags&LT != 0 && score >= old {
+		return false, nil
+	}
+	z.update(member, old, score)
+	return false, nil
+}
+
+func (z *ZSet) update(member string, old, score float64) {
+	if old == score {
+		return
+	}
+	z.sl.Delete(element{score: old, member: member})
+	z.sl.Insert(element{score: score, member: member}, nil)
+	z.dict[member] = score
+}
+
+// Remove removes member (ZREM) and reports whether it existed
+func (z *ZSet) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	delete(z.dict, member)
+	z.sl.Delete(element{score: score, member: member})
+	return true
+}
+
+// Score returns the score of member (ZSCORE)
+func (z *ZSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// IncrBy increments the score of member by incr (ZINCRBY), adding it if not exists, and returns the new score
+func (z *ZSet) IncrBy(incr float64, member string) (float64, error) {
+	old, ok := z.dict[member]
+	score := old + incr
+	if math.IsNaN(score) {
+		return 0, ErrNaN
+	}
+	if !ok {
+		z.dict[member] = score
+		z.sl.Insert(element{score: score, member: member}, nil)
+		return score, nil
+	}
+	z.update(member, old, score)
+	return score, nil
+}
+
+// Rank returns the 0-based rank of member in ascending order (ZRANK)
+func (z *ZSet) Rank(member string) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	return z.sl.Rank(element{score: score, member: member}), true
+}
+
+// RevRank returns the 0-based rank of member in descending order (ZREVRANK)
+func (z *ZSet) RevRank(member string) (int, bool) {
+	rank, ok := z.Rank(member)
+	if !ok {
+		return 0, false
+	}
+	return z.Len() - 1 - rank, true
+}
+
+// ScoreBound is a bound of a score range, use math.Inf for -inf and +inf
+type ScoreBound struct {
+	Score     float64
+	Exclusive bool
+}
+
+func (b ScoreBound) leq(score float64) bool {
+	return b.Score < score || !b.Exclusive && b.Score == score
+}
+
+func (b ScoreBound) geq(score float64) bool {
+	return score < b.Score || !b.Exclusive && b.Score == score
+}
+
+// RangeByScore returns the elements with score between min and max in ascending order (ZRANGEBYSCORE).
+// It skips offset elements and returns at most count elements, a negative count means no limit.
+func (z *ZSet) RangeByScore(min, max ScoreBound, offset, count int) []Element {
+	it := z.sl.Seek(element{score: min.Score})
+	for ; it.Valid(); it.Next() {
+		e := it.Key().(element)
+		if min.leq(e.score) {
+			break
+		}
+	}
+	return collect(it, offset, count, func(e element) bool { return max.geq(e.score) })
+}
+
+// LexBound is a bound of a member range, Unbounded stands for - as min and + as max
+type LexBound struct {
+	Member    string
+	Exclusive bool
+	Unbounded bool
+}
+
+func (b LexBound) leq(member string) bool {
+	return b.Unbounded || b.Member < member || !b.Exclusive && b.Member == member
+}
+
+func (b LexBound) geq(member string) bool {
+	return b.Unbounded || member < b.Member || !b.Exclusive && b.Member == member
+}
+
+// RangeByLex returns the elements with member between min and max (ZRANGEBYLEX).
+// Like Redis, it assumes all elements have the same score, otherwise the result is unspecified.
+// It skips offset elements and returns at most count elements, a negative count means no limit.
+func (z *ZSet) RangeByLex(min, max LexBound, offset, count int) []Element {
+	it := z.sl.First()
+	if !min.Unbounded {
+		it = z.sl.Seek(lexKey(min.Member))
+	}
+	for ; it.Valid(); it.Next() {
+		e := it.Key().(element)
+		if min.leq(e.member) {
+			break
+		}
+	}
+	return collect(it, offset, count, func(e element) bool { return max.geq(e.member) })
+}
+
+func collect(it *skiplist.Iterator, offset, count int, in func(element) bool) []Element {
+	var res []Element
+	for ; it.Valid() && offset > 0; it.Next() {
+		offset--
+	}
+	for ; it.Valid() && count != 0; it.Next() {
+		e := it.Key().(element)
+		if !in(e) {
+			break
+		}
+		res = append(res, Element{Member: e.member, Score: e.score})
+		count--
+	}
+	return res
+}
+
+// RemRangeByRank removes the elements with rank between start and stop inclusive (ZREMRANGEBYRANK),
+// negative ranks count from the highest score, and returns the number of removed elements.
+func (z *ZSet) RemRangeByRank(start, stop int) int {
+	n := z.Len()
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0
+	}
+	num, removed := z.sl.DeleteRangeByRank(start, stop+1, true)
+	for _, e := range removed {
+		delete(z.dict, e.Key.(element).member)
+	}
+	return num
+}
+
+func (z *ZSet) String() string {
+	return z.sl.String()
+}
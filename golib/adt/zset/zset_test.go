@@ -0,0 +1,95 @@
+package zset_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	. "github.com/atriw/lib/golib/adt/zset"
+)
+
+func members(es []Element) []string {
+	var ms []string
+	for _, e := range es {
+		ms = append(ms, e.Member)
+	}
+	return ms
+}
+
+func TestZSet(t *testing.T) {
+	z := New()
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		if added, err := z.Add(float64(i%3), m, 0); !added || err != nil {
+			t.Fatalf("Add: %v, expected added, actual %v %v", m, added, err)
+		}
+	}
+	// Scores: a:0 d:0 b:1 e:1 c:2
+	if z.Len() != 5 {
+		t.Errorf("Len: expected 5, actual %v", z.Len())
+	}
+	if r, _ := z.Rank("e"); r != 3 {
+		t.Errorf("Rank: expected 3, actual %v", r)
+	}
+	if r, _ := z.RevRank("e"); r != 1 {
+		t.Errorf("RevRank: expected 1, actual %v", r)
+	}
+	if _, err := z.Add(1, "a", NX|XX); err != ErrIncompatibleFlags {
+		t.Errorf("Add: expected ErrIncompatibleFlags, actual %v", err)
+	}
+	z.Add(5, "a", NX)
+	z.Add(5, "f", XX)
+	z.Add(-1, "b", GT)
+	z.Add(3, "c", LT)
+	if s, _ := z.Score("a"); s != 0 {
+		t.Errorf("Add NX: expected 0, actual %v", s)
+	}
+	if _, ok := z.Score("f"); ok {
+		t.Errorf("Add XX: expected f not added")
+	}
+	if s, _ := z.Score("b"); s != 1 {
+		t.Errorf("Add GT: expected 1, actual %v", s)
+	}
+	if s, _ := z.Score("c"); s != 2 {
+		t.Errorf("Add LT: expected 2, actual %v", s)
+	}
+	if s, _ := z.IncrBy(2.5, "a"); s != 2.5 {
+		t.Errorf("IncrBy: expected 2.5, actual %v", s)
+	}
+	if _, err := z.IncrBy(math.NaN(), "a"); err != ErrNaN {
+		t.Errorf("IncrBy: expected ErrNaN, actual %v", err)
+	}
+	// Scores: d:0 b:1 e:1 c:2 a:2.5
+	got := members(z.RangeByScore(ScoreBound{Score: 1}, ScoreBound{Score: 2.5, Exclusive: true}, 0, -1))
+	if expected := []string{"b", "e", "c"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("RangeByScore: expected %v, actual %v", expected, got)
+	}
+	got = members(z.RangeByScore(ScoreBound{Score: 0, Exclusive: true}, ScoreBound{Score: math.Inf(1)}, 1, 2))
+	if expected := []string{"e", "c"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("RangeByScore with limit: expected %v, actual %v", expected, got)
+	}
+	if !z.Remove("e") || z.Remove("e") {
+		t.Errorf("Remove: expected e removed once")
+	}
+	if n := z.RemRangeByRank(-2, -1); n != 2 {
+		t.Errorf("RemRangeByRank: expected 2, actual %v", n)
+	}
+	got = members(z.RangeByScore(ScoreBound{Score: math.Inf(-1)}, ScoreBound{Score: math.Inf(1)}, 0, -1))
+	if expected := []string{"d", "b"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("RemRangeByRank: expected %v left, actual %v", expected, got)
+	}
+}
+
+func TestZSetRangeByLex(t *testing.T) {
+	z := New()
+	for _, m := range []string{"e", "a", "c", "b", "d", "f"} {
+		z.Add(0, m, 0)
+	}
+	got := members(z.RangeByLex(LexBound{Member: "b", Exclusive: true}, LexBound{Member: "e"}, 0, -1))
+	if expected := []string{"c", "d", "e"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("RangeByLex: expected %v, actual %v", expected, got)
+	}
+	got = members(z.RangeByLex(LexBound{Unbounded: true}, LexBound{Member: "c", Exclusive: true}, 0, -1))
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("RangeByLex: expected %v, actual %v", expected, got)
+	}
+}
@@ -0,0 +1,72 @@
+package lsm
+
+import (
+	"bytes"
+)
+
+// iterator iterates over entries in key order.
+type iterator interface {
+	Valid() bool
+	Key() []byte
+	Entry() entry
+	Next()
+	Err() error
+}
+
+// mergeIterator merges iterators ordered from the newest to the oldest.
+// For a key present in several iterators, only the entry of the newest one is visible.
+type mergeIterator struct {
+	its []iterator
+	cur int
+	err error
+}
+
+func newMergeIterator(its []iterator) *mergeIterator {
+	m := &mergeIterator{its: its}
+	m.pick()
+	return m
+}
+
+// pick selects the newest iterator with the smallest key.
+func (m *mergeIterator) pick() {
+	m.cur = -1
+	for i, it := range m.its {
+		if err := it.Err(); err != nil {
+			m.err = err
+			return
+		}
+		if !it.Valid() {
+			continue
+		}
+		if m.cur < 0 || bytes.Compare(it.Key(), m.its[m.cur].Key()) < 0 {
+			m.cur = i
+		}
+	}
+}
+
+func (m *mergeIterator) Valid() bool {
+	return m.err == nil && m.cur >= 0
+}
+
+func (m *mergeIterator) Key() []byte {
+	return m.its[m.cur].Key()
+}
+
+func (m *mergeIterator) Entry() entry {
+	return m.its[m.cur].Entry()
+}
+
+// Next skips the current key in all iterators.
+func (m *mergeIterator) Next() {
+	key := m.Key()
+	for _, it := range m.its {
+		if it.Valid() && bytes.Equal(it.Key(), key) {
+			it.Next()
+		}
+	}
+	m.pick()
+}
+
+func (m *mergeIterator) Err() error {
+	return m.err
+}
@@ -0,0 +1,458 @@
+// Package lsm is a small log-structured merge-tree key-value store on local disk.
+//
+// Writes go to a skiplist memtable. When the memtable reaches its size threshold, it becomes immutable
+// and is flushed by a background goroutine to a sorted, block indexed run file of level 0.
+// When a level holds too many runs, they are merged into a single run of the next level.
+// Reads merge the memtable, the immutable memtables and the runs from the newest to the oldest,
+// and deletes are tombstones until they are merged into the last level.
+//
+// There is no write-ahead log, writes not yet flushed are lost if the process exits without Close.
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrClosed is returned by operations on a closed DB
+var ErrClosed = errors.New("lsm: closed")
+
+const (
+	defaultMemtableSize = 4 << 20
+	defaultBlockSize    = 4 << 10
+	defaultLevelRuns    = 4
+	// maxImmutables stalls writes until the background goroutine catches up.
+	maxImmutables = 2
+)
+
+// DB is a key-value store, safe for concurrent use
+type DB struct {
+	dir          string
+	memtableSize int
+	blockSize    int
+	levelRuns    int
+
+	mu   sync.RWMutex
+	cond *sync.Cond
+	mem  *memtable
+	// imm are immutable memtables from the oldest to the newest.
+	imm []*memtable
+	// levels are runs of each level from the oldest to the newest.
+	levels  [][]*run
+	seq     uint64
+	closing bool
+	closed  bool
+	bgErr   error
+	done    chan struct{}
+}
+
+// Option is DB initialization options
+type Option func(*DB)
+
+// WithMemtableSize sets the approximate size in bytes at which the memtable becomes immutable
+func WithMemtableSize(size int) Option {
+	return func(db *DB) {
+		db.memtableSize = size
+	}
+}
+
+// WithBlockSize sets the approximate size in bytes of run file blocks
+func WithBlockSize(size int) Option {
+	return func(db *DB) {
+		db.blockSize = size
+	}
+}
+
+// WithLevelRuns sets the number of runs at which a level is merged into the next level
+func WithLevelRuns(n int) Option {
+	return func(db *DB) {
+		db.levelRuns = n
+	}
+}
+
+// Open opens the DB in dir, creating dir if not exists
+func Open(dir string, opts ...Option) (*DB, error) {
+	db := &DB{
+		dir:          dir,
+		memtableSize: defaultMemtableSize,
+		blockSize:    defaultBlockSize,
+		levelRuns:    defaultLevelRuns,
+		mem:          newMemtable(),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	if db.levelRuns < 2 {
+		return nil, fmt.Errorf("lsm: level runs %v should be at least 2", db.levelRuns)
+	}
+	db.cond = sync.NewCond(&db.mu)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := db.load(); err != nil {
+		db.closeRuns()
+		return nil, err
+	}
+	go db.background()
+	return db, nil
+}
+
+// load opens the run files in dir and removes unfinished ones.
+func (db *DB) load() error {
+	files, err := ioutil.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+	var runs []*run
+	for _, fi := range files {
+		name := fi.Name()
+		path := filepath.Join(db.dir, name)
+		if strings.HasSuffix(name, ".tmp") {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		level, seq, ok := parseRunName(name)
+		if !ok {
+			continue
+		}
+		r, err := openRun(path, level, seq)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, r)
+		if seq > db.seq {
+			db.seq = seq
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].seq < runs[j].seq })
+	for _, r := range runs {
+		for len(db.levels) <= r.level {
+			db.levels = append(db.levels, nil)
+		}
+		db.levels[r.level] = append(db.levels[r.level], r)
+	}
+	return nil
+}
+
+func parseRunName(name string) (level int, seq uint64, ok bool) {
+	var l int
+	var s uint64
+	if n, err := fmt.Sscanf(name, "L%d-%d.run", &l, &s); err != nil || n != 2 || runName(l, s) != name {
+		return 0, 0, false
+	}
+	return l, s, true
+}
+
+// Put sets the value of key
+func (db *DB) Put(key, value []byte) error {
+	return db.write(key, entry{value: append([]byte(nil), value...)})
+}
+
+// Delete deletes key
+func (db *DB) Delete(key []byte) error {
+	return db.write(key, entry{deleted: true})
+}
+
+func (db *DB) write(key []byte, e entry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for db.bgErr == nil && !db.closing && len(db.imm) >= maxImmutables {
+		db.cond.Wait()
+	}
+	if db.closing {
+		return ErrClosed
+	}
+	if db.bgErr != nil {
+		return db.bgErr
+	}
+	db.mem.put(key, e)
+	if db.mem.size >= db.memtableSize {
+		db.freeze()
+	}
+	return nil
+}
+
+// freeze makes the memtable immutable, it must be called with db.mu held.
+func (db *DB) freeze() {
+	db.imm = append(db.imm, db.mem)
+	db.mem = newMemtable()
+	db.cond.Broadcast()
+}
+
+// Get returns the value of key and whether it exists.
+// The returned value must not be modified.
+func (db *DB) Get(key []byte) ([]byte, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, false, ErrClosed
+	}
+	e, ok := db.mem.get(key)
+	for i := len(db.imm) - 1; !ok && i >= 0; i-- {
+		e, ok = db.imm[i].get(key)
+	}
+	for l := 0; !ok && l < len(db.levels); l++ {
+		for i := len(db.levels[l]) - 1; !ok && i >= 0; i-- {
+			var err error
+			if e, ok, err = db.levels[l][i].get(key); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	if !ok || e.deleted {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Scan calls fn on each key in [start, end) in order until fn returns false, a nil end means no upper bound.
+// It sees the DB as of when it starts: it copies the range of the memtable and references the immutable
+// memtables and runs under the lock, and merges them after releasing it, so fn may call methods of db.
+// fn must not modify the key or value.
+func (db *DB) Scan(start, end []byte, fn func(key, value []byte) bool) (err error) {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrClosed
+	}
+	mem := db.mem.snapshot(start, end)
+	imm := append([]*memtable(nil), db.imm...)
+	var runs []*run
+	for l := range db.levels {
+		for i := len(db.levels[l]) - 1; i >= 0; i-- {
+			db.levels[l][i].ref()
+			runs = append(runs, db.levels[l][i])
+		}
+	}
+	db.mu.RUnlock()
+	defer func() {
+		for _, r := range runs {
+			if e := r.unref(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}()
+
+	its := []iterator{mem}
+	for i := len(imm) - 1; i >= 0; i-- {
+		its = append(its, imm[i].iterator(start))
+	}
+	for _, r := range runs {
+		its = append(its, r.iterator(start))
+	}
+	it := newMergeIterator(its)
+	for ; it.Valid(); it.Next() {
+		if end != nil && string(it.Key()) >= string(end) {
+			break
+		}
+		if e := it.Entry(); !e.deleted && !fn(it.Key(), e.value) {
+			break
+		}
+	}
+	return it.Err()
+}
+
+// Flush makes the memtable immutable and waits until all immutable memtables are flushed
+// and no level needs compaction.
+func (db *DB) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closing {
+		return ErrClosed
+	}
+	if db.mem.sl.Length() > 0 {
+		db.freeze()
+	}
+	db.wait()
+	return db.bgErr
+}
+
+// wait waits for background work, it must be called with db.mu held.
+func (db *DB) wait() {
+	for db.bgErr == nil && (len(db.imm) > 0 || db.compactLevel() >= 0) {
+		db.cond.Wait()
+	}
+}
+
+// Close flushes the memtable, waits for background work and closes the DB
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closing {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	if db.mem.sl.Length() > 0 {
+		db.freeze()
+	}
+	db.wait()
+	db.closing = true
+	db.cond.Broadcast()
+	db.mu.Unlock()
+	<-db.done
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closed = true
+	if err := db.closeRuns(); err != nil && db.bgErr == nil {
+		return err
+	}
+	return db.bgErr
+}
+
+func (db *DB) closeRuns() error {
+	var err error
+	for _, runs := range db.levels {
+		for _, r := range runs {
+			if e := r.unref(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// compactLevel returns the first level to compact, or -1.
+func (db *DB) compactLevel() int {
+	for l, runs := range db.levels {
+		if len(runs) >= db.levelRuns {
+			return l
+		}
+	}
+	return -1
+}
+
+// background flushes immutable memtables and compacts levels one at a time.
+func (db *DB) background() {
+	defer close(db.done)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for {
+		for db.bgErr == nil && !db.closing && len(db.imm) == 0 && db.compactLevel() < 0 {
+			db.cond.Wait()
+		}
+		if db.bgErr != nil || db.closing {
+			return
+		}
+		var err error
+		if len(db.imm) > 0 {
+			err = db.flush()
+		} else {
+			err = db.compact(db.compactLevel())
+		}
+		if err != nil {
+			db.bgErr = err
+		}
+		db.cond.Broadcast()
+	}
+}
+
+// flush writes the oldest immutable memtable to a run of level 0.
+// It must be called with db.mu held, and releases it while writing.
+func (db *DB) flush() error {
+	m := db.imm[0]
+	db.seq++
+	seq := db.seq
+	// No older data exists, tombstones can be dropped.
+	last := len(db.levels) == 0
+	db.mu.Unlock()
+	r, err := db.writeRun(0, seq, m.iterator(nil), last)
+	db.mu.Lock()
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		if len(db.levels) == 0 {
+			db.levels = append(db.levels, nil)
+		}
+		db.levels[0] = append(db.levels[0], r)
+	}
+	db.imm = db.imm[1:]
+	return nil
+}
+
+// compact merges all runs of level l into a run of level l+1.
+// It must be called with db.mu held, and releases it while merging.
+func (db *DB) compact(l int) error {
+	runs := db.levels[l]
+	db.seq++
+	seq := db.seq
+	last := true
+	for _, deeper := range db.levels[l+1:] {
+		if len(deeper) > 0 {
+			last = false
+		}
+	}
+	db.mu.Unlock()
+	var its []iterator
+	for i := len(runs) - 1; i >= 0; i-- {
+		its = append(its, runs[i].iterator(nil))
+	}
+	r, err := db.writeRun(l+1, seq, newMergeIterator(its), last)
+	db.mu.Lock()
+	if err != nil {
+		return err
+	}
+	if len(db.levels) == l+1 {
+		db.levels = append(db.levels, nil)
+	}
+	if r != nil {
+		db.levels[l+1] = append(db.levels[l+1], r)
+	}
+	// Only the background goroutine changes levels, the runs of level l are unchanged.
+	// Scans may still use them, the last reference removes their files.
+	db.levels[l] = nil
+	for _, r := range runs {
+		r.obsolete = true
+		if e := r.unref(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// writeRun writes entries of it to a new run file, dropping tombstones if last.
+// It returns a nil run if there is nothing to write.
+func (db *DB) writeRun(level int, seq uint64, it iterator, last bool) (*run, error) {
+	path := filepath.Join(db.dir, runName(level, seq))
+	w, err := newRunWriter(path+".tmp", db.blockSize)
+	if err != nil {
+		return nil, err
+	}
+	empty := true
+	for ; it.Valid(); it.Next() {
+		e := it.Entry()
+		if last && e.deleted {
+			continue
+		}
+		if err := w.add(it.Key(), e); err != nil {
+			w.abort()
+			return nil, err
+		}
+		empty = false
+	}
+	if err := it.Err(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	if empty {
+		w.abort()
+		return nil, nil
+	}
+	if err := w.finish(); err != nil {
+		os.Remove(path + ".tmp")
+		return nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return nil, err
+	}
+	return openRun(path, level, seq)
+}
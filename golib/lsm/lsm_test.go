@@ -0,0 +1,284 @@
+package lsm_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/atriw/lib/golib/lsm"
+)
+
+func open(t *testing.T, dir string) *DB {
+	db, err := Open(dir, WithMemtableSize(4<<10), WithBlockSize(256), WithLevelRuns(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func keyOf(i int) []byte {
+	return []byte(fmt.Sprintf("key%05d", i))
+}
+
+func check(t *testing.T, db *DB, model map[string]string) {
+	t.Helper()
+	for i := 0; i < 2000; i++ {
+		v, ok, err := db.Get(keyOf(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, exists := model[string(keyOf(i))]
+		if ok != exists || string(v) != expected {
+			t.Fatalf("Get: key %s, expected %q %v, actual %q %v", keyOf(i), expected, exists, v, ok)
+		}
+	}
+	var keys []string
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var scanned []string
+	err := db.Scan(nil, nil, func(key, value []byte) bool {
+		if model[string(key)] != string(value) {
+			t.Errorf("Scan: key %s, expected %q, actual %q", key, model[string(key)], value)
+		}
+		scanned = append(scanned, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(scanned) != fmt.Sprint(keys) {
+		t.Fatalf("Scan: expected %v keys, actual %v keys", len(keys), len(scanned))
+	}
+}
+
+func TestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := open(t, dir)
+	model := make(map[string]string)
+	for i := 0; i < 20000; i++ {
+		k := keyOf(rand.Intn(2000))
+		if rand.Intn(4) == 0 {
+			if err := db.Delete(k); err != nil {
+				t.Fatal(err)
+			}
+			delete(model, string(k))
+			continue
+		}
+		v := fmt.Sprint("value", i)
+		if err := db.Put(k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+		model[string(k)] = v
+	}
+	check(t, db, model)
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, db, model)
+	runs, _ := filepath.Glob(filepath.Join(dir, "L*.run"))
+	level0, _ := filepath.Glob(filepath.Join(dir, "L0-*.run"))
+	if len(runs) == len(level0) || len(level0) >= 3 {
+		t.Errorf("Compaction: expected compacted runs, actual %v", runs)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Get(keyOf(0)); err != ErrClosed {
+		t.Errorf("Get: expected ErrClosed, actual %v", err)
+	}
+
+	db = open(t, dir)
+	check(t, db, model)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBScanRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := open(t, dir)
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		db.Put(keyOf(i), keyOf(i))
+	}
+	db.Flush()
+	for i := 20; i < 30; i++ {
+		db.Delete(keyOf(i))
+	}
+	db.Put(keyOf(25), []byte("new"))
+	var got []string
+	db.Scan(keyOf(18), keyOf(32), func(key, value []byte) bool {
+		got = append(got, string(key)+"="+string(value))
+		return true
+	})
+	expected := []string{"key00018=key00018", "key00019=key00019", "key00025=new", "key00030=key00030", "key00031=key00031"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Scan: expected %v, actual %v", expected, got)
+	}
+}
+
+// TestDBScanWrite writes and compacts in fn, which must neither deadlock nor change what the scan sees.
+func TestDBScanWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := open(t, dir)
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		db.Put(keyOf(i), keyOf(i))
+	}
+	db.Flush()
+	for i := 1000; i < 1010; i++ {
+		db.Put(keyOf(i), keyOf(i))
+	}
+	var got []string
+	err = db.Scan(nil, nil, func(key, value []byte) bool {
+		if len(got) == 0 {
+			for i := 0; i < 2000; i++ {
+				if err := db.Put(keyOf(i), []byte("new")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(key) != string(value) {
+			t.Fatalf("Scan: key %s, expected value %s, actual %s", key, key, value)
+		}
+		got = append(got, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1010 {
+		t.Errorf("Scan: expected 1010 keys, actual %v", len(got))
+	}
+	if v, _, _ := db.Get(keyOf(0)); string(v) != "new" {
+		t.Errorf("Get: expected new, actual %s", v)
+	}
+}
+
+func TestDBOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := Open(dir, WithLevelRuns(1)); err == nil {
+		t.Errorf("Open: expected error on 1 level run")
+	}
+}
+
+// TestDBConcurrent runs writers on disjoint keys and scanners while the background goroutine
+// flushes and compacts, run it with -race.
+func TestDBConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := open(t, dir)
+	const writers, keys = 4, 1000
+	models := make([]map[string]string, writers)
+	done := make(chan struct{})
+	var wg, scanners sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		models[w] = make(map[string]string)
+		wg.Add(1)
+		go func(w int, model map[string]string) {
+			defer wg.Done()
+			for i := 0; i < 1500; i++ {
+				// Writer w owns the keys equal to w modulo writers, so it reads its own writes.
+				k := keyOf(rand.Intn(keys/writers)*writers + w)
+				if rand.Intn(4) == 0 {
+					if err := db.Delete(k); err != nil {
+						t.Error(err)
+						return
+					}
+					delete(model, string(k))
+				} else {
+					v := fmt.Sprintf("%s/%v", k, i)
+					if err := db.Put(k, []byte(v)); err != nil {
+						t.Error(err)
+						return
+					}
+					model[string(k)] = v
+				}
+				v, ok, err := db.Get(k)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if expected, exists := model[string(k)]; ok != exists || string(v) != expected {
+					t.Errorf("Get: key %s, expected %q %v, actual %q %v", k, expected, exists, v, ok)
+					return
+				}
+			}
+		}(w, models[w])
+	}
+	for s := 0; s < 2; s++ {
+		scanners.Add(1)
+		go func() {
+			defer scanners.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				start := rand.Intn(keys)
+				var prev string
+				err := db.Scan(keyOf(start), keyOf(start+100), func(key, value []byte) bool {
+					if string(key) <= prev || !strings.HasPrefix(string(value), string(key)+"/") {
+						t.Errorf("Scan: key %s after %s, value %q", key, prev, value)
+						return false
+					}
+					prev = string(key)
+					return true
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	scanners.Wait()
+	model := make(map[string]string)
+	for _, m := range models {
+		for k, v := range m {
+			model[k] = v
+		}
+	}
+	check(t, db, model)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = open(t, dir)
+	check(t, db, model)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+package lsm
+
+import (
+	"github.com/atriw/lib/golib/adt/skiplist"
+)
+
+// bytesKey is the key of memtable skiplist.
+type bytesKey string
+
+func (k bytesKey) Less(other interface{}) bool {
+	o, ok := other.(bytesKey)
+	return ok && k < o
+}
+
+func (k bytesKey) Equal(other interface{}) bool {
+	o, ok := other.(bytesKey)
+	return ok && k == o
+}
+
+// entry is a value or a tombstone.
+type entry struct {
+	value   []byte
+	deleted bool
+}
+
+// entryOverhead approximates the memory used by a memtable entry besides key and value.
+const entryOverhead = 64
+
+type memtable struct {
+	sl   *skiplist.Skiplist
+	size int
+}
+
+func newMemtable() *memtable {
+	return &memtable{sl: skiplist.New(skiplist.WithMaxLevel(15))}
+}
+
+func (m *memtable) put(key []byte, e entry) {
+	m.sl.Insert(bytesKey(key), e)
+	m.size += len(key) + len(e.value) + entryOverhead
+}
+
+func (m *memtable) get(key []byte) (entry, bool) {
+	v := m.sl.Search(bytesKey(key))
+	if v == nil {
+		return entry{}, false
+	}
+	return v.(entry), true
+}
+
+func (m *memtable) iterator(start []byte) iterator {
+	return &memIterator{it: m.sl.Seek(bytesKey(start))}
+}
+
+// snapshot copies the entries in [start, end) to an iterator, a nil end means no upper bound.
+func (m *memtable) snapshot(start, end []byte) iterator {
+	it := &sliceIterator{}
+	for i := m.sl.Seek(bytesKey(start)); i.Valid(); i.Next() {
+		k := i.Key().(bytesKey)
+		if end != nil && string(k) >= string(end) {
+			break
+		}
+		it.keys = append(it.keys, []byte(k))
+		it.entries = append(it.entries, i.Value().(entry))
+	}
+	return it
+}
+
+type memIterator struct {
+	it *skiplist.Iterator
+}
+
+func (i *memIterator) Valid() bool {
+	return i.it.Valid()
+}
+
+func (i *memIterator) Key() []byte {
+	return []byte(i.it.Key().(bytesKey))
+}
+
+func (i *memIterator) Entry() entry {
+	return i.it.Value().(entry)
+}
+
+func (i *memIterator) Next() {
+	i.it.Next()
+}
+
+func (i *memIterator) Err() error {
+	return nil
+}
+
+type sliceIterator struct {
+	keys    [][]byte
+	entries []entry
+	idx     int
+}
+
+func (i *sliceIterator) Valid() bool {
+	return i.idx < len(i.keys)
+}
+
+func (i *sliceIterator) Key() []byte {
+	return i.keys[i.idx]
+}
+
+func (i *sliceIterator) Entry() entry {
+	return i.entries[i.idx]
+}
+
+func (i *sliceIterator) Next() {
+	i.idx++
+}
+
+func (i *sliceIterator) Err() error {
+	return nil
+}
@@ -0,0 +1,371 @@
+package lsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// A run file is a sorted sequence of entries, grouped in blocks and indexed by the first key of each block:
+//
+//   block 0 | crc 0 | block 1 | crc 1 | ... | index | footer
+//
+// An entry is kind(1) | uvarint key length | uvarint value length | key | value.
+// An index entry is uvarint key length | first key | uvarint block offset | uvarint block length.
+// The footer is index offset(8) | index length(8) | magic(8), all little endian.
+
+const (
+	kindValue     byte = 0
+	kindTombstone byte = 1
+
+	footerSize = 24
+	runMagic   = 0x6c736d72756e0001
+)
+
+var errCorrupted = errors.New("lsm: corrupted run file")
+
+type blockHandle struct {
+	firstKey []byte
+	offset   int64
+	length   int64
+}
+
+type runWriter struct {
+	f         *os.File
+	w         *bufio.Writer
+	blockSize int
+	offset    int64
+	block     bytes.Buffer
+	first     []byte
+	index     []blockHandle
+	buf       [binary.MaxVarintLen64]byte
+}
+
+func newRunWriter(path string, blockSize int) (*runWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &runWriter{f: f, w: bufio.NewWriter(f), blockSize: blockSize}, nil
+}
+
+func (w *runWriter) putUvarint(b *bytes.Buffer, x uint64) {
+	n := binary.PutUvarint(w.buf[:], x)
+	b.Write(w.buf[:n])
+}
+
+func (w *runWriter) add(key []byte, e entry) error {
+	if w.block.Len() == 0 {
+		w.first = append([]byte(nil), key...)
+	}
+	kind := kindValue
+	if e.deleted {
+		kind = kindTombstone
+	}
+	w.block.WriteByte(kind)
+	w.putUvarint(&w.block, uint64(len(key)))
+	w.putUvarint(&w.block, uint64(len(e.value)))
+	w.block.Write(key)
+	w.block.Write(e.value)
+	if w.block.Len() >= w.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+func (w *runWriter) flushBlock() error {
+	if w.block.Len() == 0 {
+		return nil
+	}
+	length := int64(w.block.Len())
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(w.block.Bytes()))
+	if _, err := w.w.Write(w.block.Bytes()); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(crc[:]); err != nil {
+		return err
+	}
+	w.index = append(w.index, blockHandle{firstKey: w.first, offset: w.offset, length: length})
+	w.offset += length + 4
+	w.block.Reset()
+	return nil
+}
+
+// finish writes the index and the footer, syncs and closes the file.
+func (w *runWriter) finish() error {
+	if err := w.flushBlock(); err != nil {
+		w.f.Close()
+		return err
+	}
+	var index bytes.Buffer
+	for _, h := range w.index {
+		w.putUvarint(&index, uint64(len(h.firstKey)))
+		index.Write(h.firstKey)
+		w.putUvarint(&index, uint64(h.offset))
+		w.putUvarint(&index, uint64(h.length))
+	}
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[0:], uint64(w.offset))
+	binary.LittleEndian.PutUint64(footer[8:], uint64(index.Len()))
+	binary.LittleEndian.PutUint64(footer[16:], runMagic)
+	index.Write(footer[:])
+	if _, err := w.w.Write(index.Bytes()); err != nil {
+		w.f.Close()
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// abort closes and removes the unfinished file.
+func (w *runWriter) abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// run is an immutable run file of a level, runs with greater seq are newer.
+type run struct {
+	level int
+	seq   uint64
+	path  string
+	f     *os.File
+	index []blockHandle
+	// refs counts the DB and the scans using the run, the file is closed when it drops to 0,
+	// and removed if the run is obsolete, that is merged into the next level.
+	refs     int32
+	obsolete bool
+}
+
+func runName(level int, seq uint64) string {
+	return fmt.Sprintf("L%d-%016d.run", level, seq)
+}
+
+func openRun(path string, level int, seq uint64) (*run, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &run{level: level, seq: seq, path: path, f: f, refs: 1}
+	if err := r.readIndex(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *run) readIndex() error {
+	fi, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < footerSize {
+		return errCorrupted
+	}
+	var footer [footerSize]byte
+	if _, err := r.f.ReadAt(footer[:], fi.Size()-footerSize); err != nil {
+		return err
+	}
+	offset := int64(binary.LittleEndian.Uint64(footer[0:]))
+	length := int64(binary.LittleEndian.Uint64(footer[8:]))
+	if binary.LittleEndian.Uint64(footer[16:]) != runMagic || offset+length+footerSize != fi.Size() {
+		return errCorrupted
+	}
+	buf := make([]byte, length)
+	if _, err := r.f.ReadAt(buf, offset); err != nil {
+		return err
+	}
+	for len(buf) > 0 {
+		var h blockHandle
+		var n uint64
+		if n, buf, err = uvarint(buf); err != nil {
+			return err
+		}
+		if uint64(len(buf)) < n {
+			return errCorrupted
+		}
+		h.firstKey, buf = buf[:n], buf[n:]
+		if n, buf, err = uvarint(buf); err != nil {
+			return err
+		}
+		h.offset = int64(n)
+		if n, buf, err = uvarint(buf); err != nil {
+			return err
+		}
+		h.length = int64(n)
+		r.index = append(r.index, h)
+	}
+	return nil
+}
+
+func uvarint(buf []byte) (uint64, []byte, error) {
+	x, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return 0, nil, errCorrupted
+	}
+	return x, buf[n:], nil
+}
+
+// readBlock reads and verifies the ith block.
+func (r *run) readBlock(i int) ([]byte, error) {
+	h := r.index[i]
+	buf := make([]byte, h.length+4)
+	if _, err := r.f.ReadAt(buf, h.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	block := buf[:h.length]
+	if crc32.ChecksumIEEE(block) != binary.LittleEndian.Uint32(buf[h.length:]) {
+		return nil, fmt.Errorf("%v: block %v: %w", r.path, i, errCorrupted)
+	}
+	return block, nil
+}
+
+// findBlock returns the index of the last block whose first key is not greater than key, or -1.
+func (r *run) findBlock(key []byte) int {
+	return sort.Search(len(r.index), func(i int) bool {
+		return bytes.Compare(r.index[i].firstKey, key) > 0
+	}) - 1
+}
+
+func (r *run) get(key []byte) (entry, bool, error) {
+	i := r.findBlock(key)
+	if i < 0 {
+		return entry{}, false, nil
+	}
+	block, err := r.readBlock(i)
+	if err != nil {
+		return entry{}, false, err
+	}
+	for len(block) > 0 {
+		var k []byte
+		var e entry
+		if k, e, block, err = decodeEntry(block); err != nil {
+			return entry{}, false, err
+		}
+		if c := bytes.Compare(k, key); c == 0 {
+			return e, true, nil
+		} else if c > 0 {
+			break
+		}
+	}
+	return entry{}, false, nil
+}
+
+func decodeEntry(block []byte) (key []byte, e entry, rest []byte, err error) {
+	if len(block) == 0 {
+		return nil, entry{}, nil, errCorrupted
+	}
+	kind := block[0]
+	var kl, vl uint64
+	if kl, rest, err = uvarint(block[1:]); err != nil {
+		return
+	}
+	if vl, rest, err = uvarint(rest); err != nil {
+		return
+	}
+	if uint64(len(rest)) < kl+vl {
+		return nil, entry{}, nil, errCorrupted
+	}
+	key, e.value, rest = rest[:kl], rest[kl:kl+vl], rest[kl+vl:]
+	e.deleted = kind == kindTombstone
+	return key, e, rest, nil
+}
+
+func (r *run) iterator(start []byte) iterator {
+	it := &runIterator{r: r, block: -1}
+	i := r.findBlock(start)
+	if i < 0 {
+		i = 0
+	}
+	it.load(i)
+	for it.Valid() && bytes.Compare(it.key, start) < 0 {
+		it.Next()
+	}
+	return it
+}
+
+func (r *run) ref() {
+	atomic.AddInt32(&r.refs, 1)
+}
+
+// unref drops a reference, and closes the file and removes it if obsolete after the last one.
+func (r *run) unref() error {
+	if atomic.AddInt32(&r.refs, -1) > 0 {
+		return nil
+	}
+	err := r.f.Close()
+	if r.obsolete {
+		if e := os.Remove(r.path); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+type runIterator struct {
+	r     *run
+	block int
+	buf   []byte
+	key   []byte
+	e     entry
+	valid bool
+	err   error
+}
+
+// load reads the ith block and positions at its first entry.
+func (i *runIterator) load(block int) {
+	i.valid = false
+	if block >= len(i.r.index) {
+		return
+	}
+	buf, err := i.r.readBlock(block)
+	if err != nil {
+		i.err = err
+		return
+	}
+	i.block, i.buf = block, buf
+	i.decode()
+}
+
+func (i *runIterator) decode() {
+	i.key, i.e, i.buf, i.err = decodeEntry(i.buf)
+	i.valid = i.err == nil
+}
+
+func (i *runIterator) Valid() bool {
+	return i.valid
+}
+
+func (i *runIterator) Key() []byte {
+	return i.key
+}
+
+func (i *runIterator) Entry() entry {
+	return i.e
+}
+
+func (i *runIterator) Next() {
+	if len(i.buf) == 0 {
+		i.load(i.block + 1)
+		return
+	}
+	i.decode()
+}
+
+func (i *runIterator) Err() error {
+	return i.err
+}